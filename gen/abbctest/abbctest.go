@@ -0,0 +1,190 @@
+// Package abbctest builds small synthetic trait packs, so that config
+// loading, trait selection and rendering can be tested without the
+// collection artwork. It writes the config as YAML and does not import
+// abbc, so the tests of abbc itself can use it.
+package abbctest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Size is the width and height of every image in a pack.
+const Size = 32
+
+// Layers is the layer order of the default pack.
+var Layers = []string{"Background", "Fur", "Clothes", "Eyes", "Head", "Mouth", "Jewelry"}
+
+// Traits are the trait keys of the default pack by type. They include every
+// key the rules in Render match on.
+var Traits = map[string][]string{
+	"Background": {"gray", "blue"},
+	"Fur":        {"brown", "black"},
+	"Clothes":    {"hoodie", "zipped-puffer"},
+	"Eyes": {
+		"bored", "robot", "eth-lasers", "flame-shades", "geometric-shades",
+		"oversized", "plasma-vision", "sport-shades", "the-don-shades",
+		"thick-frames", "thin-shades", "bitcoin-ballers",
+	},
+	"Head": {
+		"trooper-hat", "army-helmet", "backwards-hat", "backwards-bandana",
+		"bandana", "beanie", "knit-beanie", "sweatband", "panel-hat",
+		"blonde-braids", "goggles", "sakura", "messy-hair", "dreadlocks",
+		"two-tone-braids",
+	},
+	"Mouth": {
+		"grin", "small-grin", "bored", "bored-joint", "bored-unshaven",
+		"phoneme-vuh", "discomfort", "bandana", "dumbfounded", "rose", "tongue",
+	},
+	"Jewelry": {"chain"},
+}
+
+// Tags are the tags of the default pack by type and key, the ones the rules
+// in Render look for.
+var Tags = map[string]map[string][]string{
+	"Eyes": {
+		"bitcoin-ballers":  {"glasses"},
+		"flame-shades":     {"glasses"},
+		"geometric-shades": {"glasses"},
+		"oversized":        {"glasses"},
+		"plasma-vision":    {"glasses"},
+		"sport-shades":     {"glasses"},
+		"the-don-shades":   {"glasses"},
+		"thick-frames":     {"glasses"},
+		"thin-shades":      {"glasses"},
+	},
+	"Head":  {"goggles": {"goggles"}},
+	"Mouth": {"grin": {"grin"}},
+}
+
+// config, traitValues and datum are the parts of the abbc config a pack
+// writes.
+type config struct {
+	Name   string                 `yaml:"name"`
+	Supply int                    `yaml:"supply"`
+	Layers []string               `yaml:"layers,flow"`
+	Traits map[string]traitValues `yaml:"traits"`
+}
+
+type traitValues struct {
+	Values []datum `yaml:"values"`
+}
+
+type datum struct {
+	Key    string   `yaml:"key"`
+	Name   string   `yaml:"name"`
+	Tags   []string `yaml:"tags,omitempty,flow"`
+	File   string   `yaml:"file"`
+	Chance int      `yaml:"chance"`
+	Active bool     `yaml:"active"`
+}
+
+// Write writes a pack to dir and returns the path of its config: abbc.yml,
+// one image per trait value under traits/<Type>/<key>.png, tagged from
+// Tags, and the special images, such as abbc.SpecialImageFiles(), under
+// traits/Special. Chances are split evenly within each type so that no type
+// gets an empty value.
+//
+// Backgrounds are opaque; every other image is a square of a colour derived
+// from its path, offset by its position so that layers overlap partly.
+func Write(dir string, layers []string, traits map[string][]string, specials []string) (string, error) {
+	c := &config{
+		Name:   "ABBC Test",
+		Supply: 100,
+		Layers: layers,
+		Traits: make(map[string]traitValues),
+	}
+	for i, traitType := range layers {
+		keys := traits[traitType]
+		values := []datum{}
+		for j, key := range keys {
+			file := path.Join("traits", traitType, key+".png")
+			full := i == 0
+			err := writeSquare(filepath.Join(dir, filepath.FromSlash(file)), full, i+j)
+			if err != nil {
+				return "", err
+			}
+			chance := 1000 / len(keys)
+			if j == 0 {
+				chance += 1000 % len(keys)
+			}
+			values = append(values, datum{
+				Key:    key,
+				Name:   name(key),
+				Tags:   Tags[traitType][key],
+				File:   file,
+				Chance: chance,
+				Active: true,
+			})
+		}
+		c.Traits[traitType] = traitValues{Values: values}
+	}
+
+	for i, file := range specials {
+		err := writeSquare(filepath.Join(dir, "traits", "Special", file), false, i)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	configPath := filepath.Join(dir, "abbc.yml")
+	return configPath, os.WriteFile(configPath, data, 0644)
+}
+
+func writeSquare(file string, full bool, offset int) error {
+	h := fnv.New32a()
+	h.Write([]byte(file))
+	sum := h.Sum32()
+	c := color.NRGBA{uint8(sum), uint8(sum >> 8), uint8(sum >> 16), 255}
+
+	img := image.NewNRGBA(image.Rect(0, 0, Size, Size))
+	r := img.Rect
+	if !full {
+		offset %= Size / 2
+		r = image.Rect(offset, offset, offset+Size/2, offset+Size/2)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// name turns a trait key back into a display name.
+func name(key string) string {
+	words := strings.Split(key, "-")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
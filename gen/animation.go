@@ -0,0 +1,173 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// AnimationConfig turns on writing an animated GIF of every token with an
+// animated trait value or special image, into Dir under the output directory
+// (default "animations"). With URI set, the metadata links it as
+// animation_url. Size scales the GIF down to that many pixels square.
+//
+// Specials gives frames to special images by name, such as "Laser" or
+// "Joint Smoke".
+type AnimationConfig struct {
+	Dir      string             `yaml:"dir,omitempty"`
+	URI      string             `yaml:"uri,omitempty"`
+	Size     int                `yaml:"size,omitempty"`
+	Specials map[string][]Frame `yaml:"specials,omitempty"`
+}
+
+// A Frame is one image of an animation, shown for Delay milliseconds
+// (default 100).
+type Frame struct {
+	File  string `yaml:"file"`
+	Delay int    `yaml:"delay_ms,omitempty"`
+}
+
+// An Animation is the loaded frames of a trait value or special image.
+type Animation struct {
+	Frames []image.Image
+	Delays []int
+
+	// Files are the paths of Frames relative to the config directory.
+	Files []string
+}
+
+func (a *Animation) convert() {
+	for i, frame := range a.Frames {
+		a.Frames[i] = NewLayer(frame)
+	}
+}
+
+func loadAnimation(c *Config, frames []Frame) (*Animation, error) {
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	a := &Animation{}
+	for _, frame := range frames {
+		img, err := GetImage(c.Path(frame.File))
+		if err != nil {
+			return nil, err
+		}
+		delay := frame.Delay
+		if delay <= 0 {
+			delay = 100
+		}
+		a.Frames = append(a.Frames, img)
+		a.Delays = append(a.Delays, delay)
+		a.Files = append(a.Files, frame.File)
+	}
+	return a, nil
+}
+
+// loadSpecialAnimations loads the frames of the special images named in the
+// animation config.
+func (g *Generator) loadSpecialAnimations() error {
+	g.SpecialAnimations = make(map[string]*Animation)
+	if g.Config.Animation == nil {
+		return nil
+	}
+	for name, frames := range g.Config.Animation.Specials {
+		if _, ok := g.SpecialImages[name]; !ok {
+			return fmt.Errorf("animation of unknown special image %q", name)
+		}
+		a, err := loadAnimation(g.Config, frames)
+		if err != nil {
+			return fmt.Errorf("special image %q frames: %w", name, err)
+		}
+		g.SpecialAnimations[name] = a
+	}
+	return nil
+}
+
+// animationOf returns the animation of a step image named as in Step.Image,
+// or nil.
+func (g *Generator) animationOf(name string) *Animation {
+	for traitType, traits := range g.TraitMaps {
+		for key, trait := range traits {
+			if trait.Animation != nil && traitType+"="+key == name {
+				return trait.Animation
+			}
+		}
+	}
+	for special, a := range g.SpecialAnimations {
+		if "special:"+special == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// RenderFrames renders the frames of an animated token, or returns nil if
+// nothing drawn in trace is animated. The frames of all animated images
+// advance together; the token has as many frames as the longest animation,
+// with its delays in milliseconds. The frame files are added to the files
+// of trace.
+func (g *Generator) RenderFrames(ctx context.Context, m *Metadata, trace *Trace) ([]image.Image, []int, error) {
+	var longest *Animation
+	for _, step := range trace.Steps {
+		a := g.animationOf(step.Image)
+		if a == nil {
+			continue
+		}
+		for _, file := range a.Files {
+			trace.addFile(file)
+		}
+		if longest == nil || len(a.Frames) > len(longest.Frames) {
+			longest = a
+		}
+	}
+	if longest == nil {
+		return nil, nil, nil
+	}
+
+	frames := []image.Image{}
+	for i := range longest.Frames {
+		img, _, err := g.render(ctx, m, renderOptions{animated: true, frame: i})
+		if err != nil {
+			return nil, nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		frames = append(frames, img)
+	}
+	return frames, longest.Delays, nil
+}
+
+// encodeGIF encodes the frames as a looping GIF, scaled to size pixels
+// square unless size is 0. All frames share one palette, cut by median cut
+// from the colours of every frame, so that colours do not flicker between
+// frames.
+func encodeGIF(frames []image.Image, delays []int, size int) ([]byte, error) {
+	scaled := make([]image.Image, len(frames))
+	counts := map[color.NRGBA]int{}
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		if size > 0 && bounds.Dx() != size {
+			img := image.NewRGBA(image.Rect(0, 0, size, size))
+			xdraw.CatmullRom.Scale(img, img.Bounds(), frame, bounds, xdraw.Src, nil)
+			frame = img
+		}
+		scaled[i] = frame
+		countColors(counts, frame, 0)
+	}
+	p, index := medianCutPalette(counts)
+
+	anim := &gif.GIF{}
+	for i, frame := range scaled {
+		anim.Image = append(anim.Image, toPaletted(frame, p, index))
+		anim.Delay = append(anim.Delay, (delays[i]+5)/10)
+	}
+	buf := &bytes.Buffer{}
+	err := gif.EncodeAll(buf, anim)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeGIF(t *testing.T) {
+	// Two frames of 1000 colours between them, more than a GIF palette.
+	frames := []image.Image{}
+	for f := 0; f < 2; f++ {
+		img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+		for i := 0; i < 32*32; i++ {
+			v := (i + f*500) % 1000
+			img.Set(i%32, i/32, color.RGBA{uint8(v), uint8(v >> 8 * 64), 255 - uint8(v), 255})
+		}
+		frames = append(frames, img)
+	}
+	data, err := encodeGIF(frames, []int{100, 100}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := encodeGIF(frames, []int{100, 100}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("encoding the same frames twice differs")
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 {
+		t.Fatalf("decoded %d frames, want 2", len(anim.Image))
+	}
+	if !reflect.DeepEqual(anim.Image[0].Palette, anim.Image[1].Palette) {
+		t.Error("frames have different palettes")
+	}
+	for f, frame := range anim.Image {
+		for i := 0; i < 32*32; i += 97 {
+			want := frames[f].At(i%32, i/32).(color.RGBA)
+			r, g, b, _ := frame.At(i%32, i/32).RGBA()
+			if far(r, uint32(want.R)<<8, 16<<8) || far(g, uint32(want.G)<<8, 16<<8) || far(b, uint32(want.B)<<8, 16<<8) {
+				t.Errorf("frame %d pixel %d is %d,%d,%d, want near %v", f, i, r>>8, g>>8, b>>8, want)
+			}
+		}
+	}
+}
+
+func TestRenderFrames(t *testing.T) {
+	// Animate the first Background by flipping between it and the second.
+	var first, second Datum
+	g := testPack(t, func(c *Config) {
+		backgrounds := c.Traits["Background"]
+		backgrounds.Values[0].Frames = []Frame{{File: backgrounds.Values[0].File, Delay: 200}, {File: backgrounds.Values[1].File}}
+		first, second = backgrounds.Values[0], backgrounds.Values[1]
+		c.Animation = &AnimationConfig{Dir: "animations", Size: 64}
+	})
+	m, err := g.GenerateMetadata(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		background string
+		frames     int
+		delays     []int
+	}{
+		{first.Key, 2, []int{200, 100}},
+		{second.Key, 0, nil},
+	} {
+		m.Traits[0].TraitKey = tc.background
+		_, trace, err := g.RenderTrace(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames, delays, err := g.RenderFrames(context.Background(), m, trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != tc.frames || !reflect.DeepEqual(delays, tc.delays) {
+			t.Errorf("%s: %d frames with delays %v, want %d with %v", tc.background, len(frames), delays, tc.frames, tc.delays)
+		}
+		if tc.frames > 0 && !contains(trace.Files, second.File) {
+			t.Errorf("%s: frame file %s not in the trace files %v", tc.background, second.File, trace.Files)
+		}
+	}
+
+	m.Traits[0].TraitKey = first.Key
+	token, err := g.Token(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := token.Variants[0].encode(token.encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 || anim.Delay[0] != 20 || anim.Delay[1] != 10 {
+		t.Errorf("%d frames with delays %v", len(anim.Image), anim.Delay)
+	}
+	if size := anim.Image[0].Bounds().Dx(); size != 64 {
+		t.Errorf("gif is %d pixels wide, want 64", size)
+	}
+}
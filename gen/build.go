@@ -0,0 +1,274 @@
+package abbc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A BuildGraph records the inputs of every token of a run: its traits, the
+// image files it used and the rules that applied to it. A later run can then
+// re-render only the tokens whose inputs changed.
+type BuildGraph struct {
+	Seed          int64    `json:"seed"`
+	From          int      `json:"from"`
+	To            int      `json:"to"`
+	DisabledRules []string `json:"disabled_rules,omitempty"`
+
+	// Config is the SHA-256 of the settings that apply to every token, such
+	// as the layers, variants, layouts and their fonts.
+	Config string `json:"config_sha256"`
+
+	// Files holds the SHA-256 of every file used by a token as it was when
+	// the token was rendered, by path relative to the config directory.
+	Files  map[string]string  `json:"files"`
+	Tokens map[int]*BuildNode `json:"tokens"`
+
+	mu sync.Mutex
+}
+
+// A BuildNode is the inputs of one token.
+type BuildNode struct {
+	Traits   []string `json:"traits"`
+	Mutation string   `json:"mutation,omitempty"`
+	Attempt  int      `json:"attempt,omitempty"`
+	Metadata string   `json:"metadata_sha256"`
+	Files    []string `json:"files"`
+	Rules    []string `json:"rules,omitempty"`
+}
+
+// NewBuildGraph returns an empty graph for tokens from up to but not
+// including to, rendered by g.
+func NewBuildGraph(g *Generator, from, to int) *BuildGraph {
+	return &BuildGraph{
+		Seed:   g.Seed,
+		From:   from,
+		To:     to,
+		Files:  make(map[string]string),
+		Tokens: make(map[int]*BuildNode),
+	}
+}
+
+// LoadBuildGraph reads a graph saved by Save.
+func LoadBuildGraph(path string) (*BuildGraph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &BuildGraph{}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Files == nil {
+		b.Files = make(map[string]string)
+	}
+	if b.Tokens == nil {
+		b.Tokens = make(map[int]*BuildNode)
+	}
+	return b, nil
+}
+
+// Add records the inputs of a rendered token.
+func (b *BuildGraph) Add(t *Token) {
+	node := &BuildNode{
+		Traits:   traitList(t.Metadata),
+		Mutation: t.Metadata.Mutation,
+		Attempt:  t.Metadata.Attempt,
+		Metadata: metadataHash(t.JSON),
+	}
+	if t.Trace != nil {
+		node.Files = t.Trace.Files
+		node.Rules = t.Trace.Rules
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Tokens[t.Metadata.TokenID] = node
+	for file, sum := range t.Inputs {
+		b.Files[file] = sum
+	}
+}
+
+// Save records the rules g has disabled and its config, drops the hashes of
+// files no token uses any more, and writes the graph to path.
+func (b *BuildGraph) Save(path string, g *Generator) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.DisabledRules = []string{}
+	for name := range g.DisabledRules {
+		b.DisabledRules = append(b.DisabledRules, name)
+	}
+	sort.Strings(b.DisabledRules)
+	b.Config = g.configHash()
+	used := make(map[string]bool)
+	for _, node := range b.Tokens {
+		for _, file := range node.Files {
+			used[file] = true
+		}
+	}
+	for file := range b.Files {
+		if !used[file] {
+			delete(b.Files, file)
+		}
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+// Changed returns the tokens of the graph that g would render differently,
+// each with the reason. g should have the seed of the graph.
+func (b *BuildGraph) Changed(g *Generator) (map[int]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	configChanged := g.configHash() != b.Config
+	changedFiles := make(map[string]bool)
+	for file, sum := range b.Files {
+		if fileHash(g.Config.Path(file)) != sum {
+			changedFiles[file] = true
+		}
+	}
+	changedRules := make(map[string]bool)
+	for _, name := range b.DisabledRules {
+		if !g.DisabledRules[name] {
+			changedRules[name] = true
+		}
+	}
+	for name := range g.DisabledRules {
+		if !contains(b.DisabledRules, name) {
+			changedRules[name] = true
+		}
+	}
+
+	changed := make(map[int]string)
+	for tokenID := b.From; tokenID < b.To; tokenID++ {
+		node := b.Tokens[tokenID]
+		if node == nil {
+			changed[tokenID] = "not built"
+			continue
+		}
+		if configChanged {
+			changed[tokenID] = "config changed"
+			continue
+		}
+		m, err := g.generateMetadata(tokenID, node.Attempt)
+		if err != nil {
+			return nil, err
+		}
+		if traits := traitList(m); strings.Join(traits, ",") != strings.Join(node.Traits, ",") {
+			changed[tokenID] = "traits changed to " + strings.Join(traits, ", ")
+			continue
+		}
+		if m.Mutation != node.Mutation {
+			changed[tokenID] = fmt.Sprintf("mutation changed to %q", m.Mutation)
+			continue
+		}
+		if metadataHash(g.TokenMetadata(m)) != node.Metadata {
+			changed[tokenID] = "metadata changed"
+			continue
+		}
+		for _, file := range node.Files {
+			if changedFiles[file] {
+				changed[tokenID] = file + " changed"
+				break
+			}
+		}
+		if changed[tokenID] != "" {
+			continue
+		}
+		for _, name := range node.Rules {
+			if changedRules[name] {
+				changed[tokenID] = "rule " + name + " switched"
+				break
+			}
+		}
+	}
+	return changed, nil
+}
+
+// Forget removes tokens from the graph, so that they count as not built
+// until they are added again.
+func (b *BuildGraph) Forget(tokens map[int]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for tokenID := range tokens {
+		delete(b.Tokens, tokenID)
+	}
+}
+
+// configHash returns the SHA-256 of the settings of g that apply to every
+// token but are not recorded per token, with the fonts of the layouts.
+func (g *Generator) configHash() string {
+	c := g.Config
+	fonts := []string{}
+	for _, layout := range g.layouts {
+		fonts = append(fonts, layout.fontHash)
+	}
+	data, err := json.Marshal(struct {
+		Layers     []string
+		ImageURI   string
+		Cutout     *CutoutConfig
+		Animation  *AnimationConfig
+		Preview    *PreviewConfig
+		Encode     EncodeConfig
+		Mutations  []Mutation
+		Visibility VisibilityConfig
+		Layouts    []Layout
+		Fonts      []string
+	}{c.Layers, c.ImageURI, c.Cutout, c.Animation, c.Preview, c.Encode, c.Mutations, c.Visibility, c.Layouts, fonts})
+	if err != nil {
+		return ""
+	}
+	return hash(data)
+}
+
+// inputHashes caches the hashes of the files tokens are rendered from, so
+// that each is read once per run.
+type inputHashes struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+// hashInputs returns the SHA-256 of files, by path relative to the config
+// directory. A file is hashed the first time a token uses it.
+func (g *Generator) hashInputs(files []string) map[string]string {
+	sums := make(map[string]string, len(files))
+	for _, file := range files {
+		if g.inputs == nil {
+			sums[file] = fileHash(g.Config.Path(file))
+			continue
+		}
+		g.inputs.mu.Lock()
+		sum, ok := g.inputs.sums[file]
+		if !ok {
+			sum = fileHash(g.Config.Path(file))
+			g.inputs.sums[file] = sum
+		}
+		g.inputs.mu.Unlock()
+		sums[file] = sum
+	}
+	return sums
+}
+
+func metadataHash(tm *TokenMetadata) string {
+	data, err := json.Marshal(tm)
+	if err != nil {
+		return ""
+	}
+	return hash(data)
+}
+
+func traitList(m *Metadata) []string {
+	traits := []string{}
+	for _, trait := range m.Traits {
+		traits = append(traits, trait.TraitType+"="+trait.TraitKey)
+	}
+	return traits
+}
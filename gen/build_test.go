@@ -0,0 +1,113 @@
+package abbc
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mroth/weightedrand"
+)
+
+func TestBuildGraphChanged(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"gray.png", "brown.png", "black.png"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	furs := []weightedrand.Choice{{Item: "brown", Weight: 1}, {Item: "black", Weight: 1}}
+	furChooser, err := weightedrand.NewChooser(furs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backgroundChooser, err := weightedrand.NewChooser(weightedrand.Choice{Item: "gray", Weight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := image.Rect(0, 0, 1262, 1262)
+	g := &Generator{
+		Seed:   1,
+		Config: &Config{Dir: dir, Layers: []string{"Background", "Fur"}},
+		TraitChoosers: map[string]*weightedrand.Chooser{
+			"Background": backgroundChooser,
+			"Fur":        furChooser,
+		},
+		TraitMaps: map[string]map[string]TraitData{
+			"Background": {
+				"gray": {TraitValue: "Gray", TraitFile: "gray.png", TraitImage: solidLayer(full, color.Gray{128})},
+			},
+			"Fur": {
+				"brown": {TraitValue: "Brown", TraitFile: "brown.png", TraitImage: solidLayer(image.Rect(200, 200, 900, 1262), color.RGBA{100, 60, 20, 255})},
+				"black": {TraitValue: "Black", TraitFile: "black.png", TraitImage: solidLayer(image.Rect(200, 200, 900, 1262), color.Black)},
+			},
+		},
+	}
+
+	graph := NewBuildGraph(g, 0, 8)
+	p := &Pipeline{Generator: g, Sink: &DirSink{Dir: dir, Graph: graph}, Workers: 2}
+	if failures := p.Run(context.Background(), 0, 8); len(failures) != 0 {
+		t.Fatal(failures[0])
+	}
+	// Files edited after the tokens were rendered count as changed, even
+	// before the graph is saved.
+	if err := os.WriteFile(filepath.Join(dir, "gray.png"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	graphPath := filepath.Join(dir, "build.json")
+	if err := graph.Save(graphPath, g); err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err = LoadBuildGraph(graphPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := graph.Changed(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 8 || changed[0] != "gray.png changed" {
+		t.Fatalf("changed %v after editing gray.png", changed)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gray.png"), []byte("gray.png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = graph.Changed(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("changed %v after restoring gray.png", changed)
+	}
+
+	g.Config.Encode.Compression = "best"
+	changed, err = graph.Changed(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 8 || changed[0] != "config changed" {
+		t.Fatalf("changed %v after changing the compression", changed)
+	}
+	g.Config.Encode.Compression = ""
+
+	if err := os.WriteFile(filepath.Join(dir, "black.png"), []byte("fixed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err = graph.Changed(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) == 0 {
+		t.Fatal("no tokens changed after editing black.png")
+	}
+	for tokenID := 0; tokenID < 8; tokenID++ {
+		black := contains(graph.Tokens[tokenID].Traits, "Fur=black")
+		if reason := changed[tokenID]; black != (reason == "black.png changed") {
+			t.Errorf("token %d with black fur %v: changed %q", tokenID, black, reason)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package abbc
+
+import (
+	"container/list"
+	"image"
+	"strings"
+	"sync"
+)
+
+// PrefixCache keeps composites of the first layers of tokens, such as
+// Background and Fur, so that tokens sharing them start from a copy instead
+// of drawing them again. Least recently used composites are evicted once
+// Budget is exceeded. PrefixCache is safe for concurrent use.
+type PrefixCache struct {
+	// Layers is the most layers a composite covers. Layers whose turn can
+	// fire a rule end the prefix early.
+	Layers int
+
+	// Budget is the most bytes of pixels kept.
+	Budget int
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+
+	hits, misses int
+}
+
+type prefixEntry struct {
+	key string
+	img *image.RGBA
+}
+
+// NewPrefixCache returns a cache of composites of up to layers layers using
+// at most budget bytes.
+func NewPrefixCache(layers, budget int) *PrefixCache {
+	return &PrefixCache{
+		Layers:  layers,
+		Budget:  budget,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// prefix returns how many of traits, which are in layer order, make up the
+// cacheable prefix, and the cache key for them.
+func (c *PrefixCache) prefix(traits []MetadataTrait) (int, string) {
+	keys := []string{}
+	layers := 0
+	n := 0
+	for i, trait := range traits {
+		if ruleTraitTypes[trait.TraitType] {
+			break
+		}
+		if i == 0 || traits[i-1].TraitType != trait.TraitType {
+			if layers == c.Layers {
+				break
+			}
+			layers++
+		}
+		keys = append(keys, trait.TraitType+"="+trait.TraitKey)
+		n++
+	}
+	return n, strings.Join(keys, ",")
+}
+
+func (c *PrefixCache) get(key string) *image.RGBA {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*prefixEntry).img
+}
+
+func (c *PrefixCache) add(key string, img *image.RGBA) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok || len(img.Pix) > c.Budget {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&prefixEntry{key: key, img: img})
+	c.size += len(img.Pix)
+	for c.size > c.Budget {
+		e := c.lru.Back()
+		entry := e.Value.(*prefixEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.img.Pix)
+	}
+}
+
+// Stats returns the number of lookups that found a composite and that did
+// not, and the bytes currently kept.
+func (c *PrefixCache) Stats() (hits, misses, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.size
+}
+
+// drawPrefix copies the composite of the first layers of traits into img,
+// drawing and caching it on a miss, and returns how many traits it covered.
+func (g *Generator) drawPrefix(img *image.RGBA, traits []MetadataTrait) int {
+	n, key := g.Prefixes.prefix(traits)
+	if n == 0 {
+		return 0
+	}
+	prefix := g.Prefixes.get(key)
+	if prefix == nil {
+		prefix = image.NewRGBA(img.Rect)
+		for _, trait := range traits[:n] {
+			if trait.TraitKey == NoneKey {
+				continue
+			}
+			drawLayer(prefix, g.TraitMaps[trait.TraitType][trait.TraitKey].TraitImage)
+		}
+		g.Prefixes.add(key, prefix)
+	}
+	copy(img.Pix, prefix.Pix)
+	return n
+}
@@ -0,0 +1,82 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidLayer(r image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 1262, 1262))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return NewLayer(img)
+}
+
+func TestPrefixCache(t *testing.T) {
+	g := &Generator{
+		Config: &Config{},
+		TraitMaps: map[string]map[string]TraitData{
+			"Background": {
+				"gray": {TraitImage: solidLayer(image.Rect(0, 0, 1262, 1262), color.RGBA{128, 128, 128, 255})},
+				"blue": {TraitImage: solidLayer(image.Rect(0, 0, 1262, 1262), color.RGBA{0, 0, 255, 255})},
+			},
+			"Fur": {
+				"brown": {TraitImage: solidLayer(image.Rect(200, 200, 1000, 1262), color.RGBA{100, 60, 20, 255})},
+			},
+			"Clothes": {
+				"vest": {TraitImage: solidLayer(image.Rect(300, 900, 900, 1262), color.RGBA{0, 64, 0, 128})},
+			},
+		},
+	}
+	tokens := []*Metadata{}
+	for _, background := range []string{"gray", "blue", "gray"} {
+		tokens = append(tokens, &Metadata{Traits: []MetadataTrait{
+			{TraitType: "Background", TraitKey: background},
+			{TraitType: "Fur", TraitKey: "brown"},
+			{TraitType: "Clothes", TraitKey: "vest"},
+		}})
+	}
+
+	want := []*image.RGBA{}
+	for _, m := range tokens {
+		img, err := g.Render(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, img.(*image.RGBA))
+	}
+
+	// Room for one composite, so the second gray token misses again.
+	g.Prefixes = NewPrefixCache(2, 1262*1262*4)
+	for i, m := range tokens {
+		img, err := g.Render(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(img.(*image.RGBA).Pix, want[i].Pix) {
+			t.Errorf("token %d differs from the uncached render", i)
+		}
+	}
+	if hits, misses, _ := g.Prefixes.Stats(); hits != 0 || misses != 3 {
+		t.Errorf("got %d hits and %d misses, want 0 and 3", hits, misses)
+	}
+
+	g.Prefixes = NewPrefixCache(2, 2*1262*1262*4)
+	for _, m := range tokens {
+		g.Render(context.Background(), m)
+	}
+	if hits, misses, size := g.Prefixes.Stats(); hits != 1 || misses != 2 || size != 2*1262*1262*4 {
+		t.Errorf("got %d hits, %d misses and %d bytes, want 1, 2 and two composites", hits, misses, size)
+	}
+
+	n, key := g.Prefixes.prefix(tokens[0].Traits)
+	if n != 2 || key != "Background=gray,Fur=brown" {
+		t.Errorf("prefix is %d traits %q, want Background and Fur", n, key)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	abbc "abbc/gen"
+
+	"github.com/goccy/go-yaml"
+)
+
+// configCommand runs the gen config subcommands.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "render" {
+		return fmt.Errorf("usage: gen config render [--config file]")
+	}
+
+	flags := flag.NewFlagSet("config render", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	flags.Parse(args[1:])
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	return encoder.Encode(c)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	abbc "abbc/gen"
+)
+
+// coverageSink passes tokens on to Sink and counts the rules and special
+// images they used.
+type coverageSink struct {
+	abbc.Sink
+	Coverage *abbc.Coverage
+}
+
+func (s *coverageSink) Write(t *abbc.Token) error {
+	err := s.Sink.Write(t)
+	if err == nil {
+		s.Coverage.Add(t)
+	}
+	return err
+}
+
+func writeCoverage(path string, report *abbc.CoverageReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
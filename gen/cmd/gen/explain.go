@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	abbc "abbc/gen"
+)
+
+// explainCommand prints the steps that produced a token: the trace written
+// by gen generate --trace, or with none a fresh render of the token.
+func explainCommand(args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	seed := flags.Int64("seed", int64(time.Now().Year()), "seed for picking traits (default the seed in build.json)")
+	render := flags.Bool("render", false, "render the token again even if its trace was written")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: gen explain [flags] <token id>")
+	}
+	tokenID, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("token id %q: %w", flags.Arg(0), err)
+	}
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	outputDir := c.Path(c.OutputDir)
+
+	tracePath := filepath.Join(outputDir, fmt.Sprintf("%d.trace.json", tokenID))
+	data, err := os.ReadFile(tracePath)
+	if err == nil && !*render {
+		trace := &abbc.Trace{}
+		err = json.Unmarshal(data, trace)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tracePath, err)
+		}
+		fmt.Printf("token %d, from %s\n", tokenID, tracePath)
+		return printTrace(trace)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		return err
+	}
+	g.Seed = *seed
+	seedSet := false
+	flags.Visit(func(f *flag.Flag) {
+		seedSet = seedSet || f.Name == "seed"
+	})
+	if !seedSet {
+		graph, err := abbc.LoadBuildGraph(filepath.Join(outputDir, "build.json"))
+		if err == nil {
+			g.Seed = graph.Seed
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	m, err := g.GenerateMetadata(tokenID)
+	if err != nil {
+		return err
+	}
+	t, err := g.Token(context.Background(), m)
+	if err != nil {
+		return err
+	}
+	traits := []string{}
+	for _, trait := range t.Metadata.Traits {
+		traits = append(traits, trait.TraitType+"="+trait.TraitKey)
+	}
+	fmt.Printf("token %d, rendered with seed %d\n", tokenID, g.Seed)
+	fmt.Printf("traits: %s\n", strings.Join(traits, ", "))
+	if t.Metadata.Attempt > 0 {
+		fmt.Printf("re-rolled %d times\n", t.Metadata.Attempt)
+	}
+	return printTrace(t.Trace)
+}
+
+func printTrace(trace *abbc.Trace) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nSTEP\tLAYER\tOP\tIMAGE\tCROP\tRULE")
+	for i, step := range trace.Steps {
+		crop, rule := "-", "-"
+		if step.Crop != nil {
+			crop = fmt.Sprintf("(%d,%d)-(%d,%d)", step.Crop[0], step.Crop[1], step.Crop[2], step.Crop[3])
+		}
+		if step.Rule != "" {
+			rule = step.Rule
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, step.Layer, step.Op, step.Image, crop, rule)
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(trace.Rules) > 0 {
+		fmt.Printf("rules applicable: %s\n", strings.Join(trace.Rules, ", "))
+	}
+	if len(trace.Hidden) > 0 {
+		fmt.Printf("hidden: %s\n", strings.Join(trace.Hidden, ", "))
+	}
+	fmt.Printf("files: %s\n", strings.Join(trace.Files, ", "))
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	abbc "abbc/gen"
+)
+
+// hiddenSink passes tokens on to Sink and keeps the ones that still have
+// hidden traits.
+type hiddenSink struct {
+	abbc.Sink
+
+	mu     sync.Mutex
+	tokens []hiddenToken
+}
+
+type hiddenToken struct {
+	TokenID int                `json:"token_id"`
+	Hidden  []string           `json:"hidden"`
+	Visible map[string]float64 `json:"visible"`
+}
+
+func (s *hiddenSink) Write(t *abbc.Token) error {
+	err := s.Sink.Write(t)
+	if err != nil || t.Trace == nil || len(t.Trace.Hidden) == 0 {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append(s.tokens, hiddenToken{
+		TokenID: t.Metadata.TokenID,
+		Hidden:  t.Trace.Hidden,
+		Visible: t.Trace.Visible,
+	})
+	return nil
+}
+
+// writeReport writes the kept tokens sorted by token ID.
+func (s *hiddenSink) writeReport(path string) error {
+	sort.Slice(s.tokens, func(i, j int) bool {
+		return s.tokens[i].TokenID < s.tokens[j].TokenID
+	})
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -1,955 +1,241 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"image"
+	"io/fs"
 	"log"
-	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
-	"sync"
-	"text/tabwriter"
 	"time"
 
-	"image/color"
-	"image/draw"
-	"image/png"
+	abbc "abbc/gen"
 
-	"github.com/goccy/go-yaml"
-	"github.com/mroth/weightedrand"
-	"github.com/oliamb/cutter"
 	"github.com/schollz/progressbar/v3"
 )
-type Trait struct {
-	TraitType  string
-	TraitValue string
-	Weight     float64
-}
-
-type TraitData struct {
-	TraitType        string
-	TraitValue       string
-	TraitProbability int
-	TraitImage       image.Image
-}
-
-func (g *Generator) GetRandomTrait(traitType string) (string, error) {
-	result := g.TraitChoosers[traitType].Pick().(string)
-	return result, nil
-}
 
-type Datum struct {
-	Name   string `yaml:"name"`
-	File   string `yaml:"file"`
-	Chance int    `yaml:"chance"`
-	Active bool   `yaml:"active"`
-}
-
-type YamlTraitData struct {
-	Values []Datum `yaml:"values"`
-}
-
-type Data struct {
-	Traits map[string]YamlTraitData `yaml:"traits"`
-}
-
-func GetTraits(wantedTraitType string) (map[string]TraitData, error) {
-
-	dataFile, err := os.Open(filepath.FromSlash("./abbc.yml"))
-	if err != nil {
-		return nil, err
+func main() {
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "", "generate":
+		err = generateCommand(args)
+	case "config":
+		err = configCommand(args)
+	case "rebuild":
+		err = rebuildCommand(args)
+	case "overlaps":
+		err = overlapsCommand(args)
+	case "explain":
+		err = explainCommand(args)
+	case "sheet":
+		err = sheetCommand(args)
+	case "pairs":
+		err = pairsCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
 	}
-
-	d := &Data{}
-	decoder := yaml.NewDecoder(dataFile)
-	err = decoder.Decode(d)
 	if err != nil {
-		return nil, err
-	}
-
-	totalProbability := 0
-	traits := []TraitData{}
-
-	for traitType, traitData := range d.Traits {
-		// fmt.Println(traitType, traitData)
-		if traitType != wantedTraitType {
-			continue
-		}
-		for _, traitDatum := range traitData.Values {
-			// fmt.Println(traitType, traitDatum.Name)
-			img, err := GetImage(traitDatum.File)
-			if err != nil {
-				return nil, err
-			}
-			totalProbability += traitDatum.Chance
-			traits = append(traits, TraitData{
-				TraitValue:       traitDatum.Name,
-				TraitProbability: traitDatum.Chance,
-				TraitImage:       img,
-			})
-		}
-	}
-
-	traitMap := make(map[string]TraitData)
-	fmt.Println(wantedTraitType)
-	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-
-	for _, trait := range traits {
-		fmt.Fprintf(w, "%s\t%s\t%.01f%%\n", wantedTraitType, trait.TraitValue, float64(trait.TraitProbability)/10)
-		traitMap[trait.TraitValue] = trait
-	}
-
-	fmt.Fprintf(w, "Total\tPercentage:\t%.01f%%\n", float64(totalProbability)/10)
-
-	if totalProbability < 1000 {
-		traitMap["__NONE__"] = TraitData{
-			TraitType:        wantedTraitType,
-			TraitValue:       "__NONE__",
-			TraitProbability: 1000 - totalProbability,
-		}
+		log.Fatal(err)
 	}
-
-	w.Flush()
-	fmt.Println()
-	return traitMap, nil
 }
 
-// func (g *Generator) GetRandomTrait(traitType string) (string, error) {
-// 	traitMap := g.TraitMaps[traitType]
-// 	traitValue, err := GetRandomTrait(traitMap)
-// 	if err != nil {
-// 		return "", err
-// 	}
-// 	return traitValue, nil
-// }
-
-type Generator struct {
-	TraitChoosers map[string]*weightedrand.Chooser
-	TraitMaps     map[string]map[string]TraitData
-	SpecialImages map[string]image.Image
-}
-
-func newGenerator(imagesPath string) (*Generator, error) {
-	g := &Generator{
-		TraitMaps:     make(map[string]map[string]TraitData),
-		TraitChoosers: make(map[string]*weightedrand.Chooser),
-		SpecialImages: make(map[string]image.Image),
-	}
-	traits := []string{"Background", "Fur", "Clothes", "Eyes", "Mouth", "Head", "Jewelry"}
-	for _, trait := range traits {
-		traitMap, err := GetTraits(trait)
-		if err != nil {
-			return nil, err
-		}
-		g.TraitMaps[trait] = traitMap
-
-		keys := make([]string, 0, len(traitMap))
-		for k := range traitMap {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-
-		choices := []weightedrand.Choice{}
-		for _, k := range keys {
-			// fmt.Println(k)
-			choices = append(choices, weightedrand.Choice{
-				Item:   k,
-				Weight: uint(traitMap[k].TraitProbability),
-			})
-		}
-
-		chooser, err := weightedrand.NewChooser(choices...)
-		if err != nil {
-			return nil, err
-		}
-
-		g.TraitChoosers[trait] = chooser
-	}
-
-	imagePath := fmt.Sprintf("%s/Special/Grin Left.png", imagesPath)
-	img, err := GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Grin Left"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Bandana Left.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Bandana Left"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/BTC Ballers Top.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["BTC Ballers Top"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Trooper Hat Right.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Trooper Hat Right"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Joint Smoke.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Joint Smoke"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Sport shades cut bottom.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Sport shades"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Flame shades cut bottom.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Flame shades"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Plasma vision cut bottom.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Plasma vision cut bottom"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Plasma vision.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Plasma vision"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Bitcoin ballers cut bottom.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Bitcoin ballers"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Nostril.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Nostril"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Plasma vision bottom.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["Plasma vision bottom"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Laser.png", imagesPath)
-	img, err = GetImage(imagePath)
+func generateCommand(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	keepGoing := flags.Bool("keep-going", false, "keep generating after a token fails and write failures.json")
+	resume := flags.Bool("resume", false, "skip tokens the journal of an earlier run lists whose files are unchanged")
+	seed := flags.Int64("seed", int64(time.Now().Year()), "seed for picking traits")
+	workers := flags.Int("workers", runtime.NumCPU(), "goroutines per pipeline stage")
+	count := flags.Int("count", 0, "number of tokens (default the supply in the config)")
+	from := flags.Int("from", 0, "first token ID")
+	to := flags.Int("to", 0, "token ID to stop before (default from + count)")
+	cacheLayers := flags.Int("cache-layers", 2, "first layers to cache composites of between tokens, 0 to turn off")
+	cacheMB := flags.Int("cache-mb", 512, "memory budget in MB for cached composites")
+	trace := flags.Bool("trace", false, "write the render trace of every token as {id}.trace.json")
+	flags.Parse(args)
+
+	c, err := abbc.LoadConfig(*configPath)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["Laser"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Oversized Goggle Line.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	if *count == 0 {
+		*count = c.Supply
 	}
-	g.SpecialImages["Oversized Goggle Line"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/Trooper Hat Bandana.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	if *to == 0 {
+		*to = *from + *count
 	}
-	g.SpecialImages["Trooper Hat Bandana"] = img
 
-	imagePath = fmt.Sprintf("%s/Special/bored-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
+	g, err := abbc.NewGenerator(c)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["bored-puffer-mouth"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/bored-unshaven-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	g.Seed = *seed
+	if *cacheLayers > 0 {
+		g.Prefixes = abbc.NewPrefixCache(*cacheLayers, *cacheMB<<20)
 	}
-	g.SpecialImages["bored-unshaven-puffer-mouth"] = img
+	g.PrintTraits(os.Stdout)
 
-	imagePath = fmt.Sprintf("%s/Special/phenome-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
+	outputDir := c.Path(c.OutputDir)
+	err = os.MkdirAll(outputDir, 0777)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["phenome-puffer-mouth"] = img
 
-	imagePath = fmt.Sprintf("%s/Special/tongue-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	journalPath := filepath.Join(outputDir, "journal.jsonl")
+	finished := map[int]bool{}
+	if *resume {
+		entries, err := abbc.ReadJournal(journalPath)
+		if err != nil {
+			return err
+		}
+		// Resume with the seed of the interrupted run unless one is given.
+		seedSet := false
+		flags.Visit(func(f *flag.Flag) {
+			seedSet = seedSet || f.Name == "seed"
+		})
+		if !seedSet && len(entries) > 0 {
+			g.Seed = entries[len(entries)-1].Seed
+		}
+		finished = abbc.FinishedTokens(outputDir, entries, g.Seed, g.Config.VariantDirs())
 	}
-	g.SpecialImages["tongue-puffer-mouth"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/grin-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
+	journal, err := abbc.CreateJournal(journalPath, *resume)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["grin-puffer-mouth"] = img
+	defer journal.Close()
 
-	imagePath = fmt.Sprintf("%s/Special/small-grin-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	graphPath := filepath.Join(outputDir, "build.json")
+	graph := abbc.NewBuildGraph(g, *from, *to)
+	if *resume {
+		graph, err = resumeBuildGraph(graphPath, graph)
+		if err != nil {
+			return err
+		}
 	}
-	g.SpecialImages["small-grin-puffer-mouth"] = img
 
-	imagePath = fmt.Sprintf("%s/Special/discomfort-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	sizes := &sizeSink{
+		Sink: &abbc.DirSink{Dir: outputDir, Traces: *trace, Journal: journal, Graph: graph},
 	}
-	g.SpecialImages["discomfort-puffer-mouth"] = img
+	hidden := &hiddenSink{Sink: sizes}
+	coverage := &coverageSink{Sink: hidden, Coverage: abbc.NewCoverage(g)}
 
-	imagePath = fmt.Sprintf("%s/Special/rose-puffer-mouth.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	bar := progressbar.Default(int64(*to - *from))
+	for tokenID := range finished {
+		if tokenID >= *from && tokenID < *to {
+			bar.Add(1)
+		}
 	}
-	g.SpecialImages["rose-puffer-mouth"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/beanie-oversized-eyes.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	p := &abbc.Pipeline{
+		Generator: g,
+		Sink:      coverage,
+		Workers:   *workers,
+		KeepGoing: *keepGoing,
+		Skip:      finished,
+		OnToken: func(tokenID int, err *abbc.TokenError) {
+			bar.Add(1)
+		},
 	}
-	g.SpecialImages["beanie-oversized-eyes"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/beanie-oversized-head.png", imagesPath)
-	img, err = GetImage(imagePath)
+	failures := p.Run(context.Background(), *from, *to)
+	err = graph.Save(graphPath, g)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
-	}
-	g.SpecialImages["beanie-oversized-head"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/backwards-bandana-thick-frame-glasses.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["backwards-bandana-thick-frame-glasses"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/goggles-robot-head.png", imagesPath)
-	img, err = GetImage(imagePath)
+	sizes.printSizes(os.Stdout)
+	coveragePath := filepath.Join(outputDir, "coverage.json")
+	report := coverage.Coverage.Report()
+	err = writeCoverage(coveragePath, report)
 	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		return err
 	}
-	g.SpecialImages["goggles-robot-head"] = img
-
-	imagePath = fmt.Sprintf("%s/Special/blonde-braids-oversized-glasses.png", imagesPath)
-	img, err = GetImage(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+	if len(report.NeverFired) > 0 {
+		fmt.Printf("%d rules never fired: %s\n", len(report.NeverFired), strings.Join(report.NeverFired, ", "))
 	}
-	g.SpecialImages["blonde-braids-oversized-glasses"] = img
-
-	return g, nil
-}
-
-type Metadata struct {
-	TokenID int
-	Traits  []struct {
-		TraitType  string
-		TraitValue string
+	if len(report.NeverDrawn) > 0 {
+		fmt.Printf("%d special images never drawn: %s\n", len(report.NeverDrawn), strings.Join(report.NeverDrawn, ", "))
 	}
-}
-
-	func (g *Generator) GenerateMetadata(tokenID int) (*Metadata, error) {
-	traits := []string{"Background", "Fur", "Clothes", "Eyes", "Head", "Mouth", "Jewelry"}
-	traitValues := []string{}
-	for _, trait := range traits {
-		traitValue, err := g.GetRandomTrait(trait)
+	fmt.Printf("rule coverage in %s\n", coveragePath)
+	if len(hidden.tokens) > 0 {
+		hiddenPath := filepath.Join(outputDir, "hidden.json")
+		err = hidden.writeReport(hiddenPath)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		traitValues = append(traitValues, traitValue)
+		fmt.Printf("%d tokens have hidden traits, see %s\n", len(hidden.tokens), hiddenPath)
 	}
 
-	m := &Metadata{
-		TokenID: tokenID,
+	if len(failures) == 0 {
+		return nil
 	}
-	for i, trait := range traits {
-		m.Traits = append(m.Traits, struct {
-			TraitType  string
-			TraitValue string
-		}{
-			TraitType:  trait,
-			TraitValue: traitValues[i],
-		})
+	if !*keepGoing {
+		return failures[0]
 	}
-	return m, nil
-}
 
-
-func GetImage(path string) (image.Image, error) {
-	imageFile, err := os.Open(filepath.FromSlash(path))
+	reportPath := filepath.Join(outputDir, "failures.json")
+	err = writeFailures(reportPath, failures)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer imageFile.Close()
-	img, _, err := image.Decode(imageFile)
-	return img, err
-}
-
-type colorChanger interface {
-	Set(x, y int, c color.Color)
-	At(x, y int) color.Color
+	return fmt.Errorf("%d of %d tokens failed, see %s", len(failures), *to-*from, reportPath)
 }
 
-func (g *Generator) GenerateImage(m *Metadata) error {
-	r := image.Rectangle{image.Point{0, 0}, image.Point{1262, 1262}}
-	newImage := image.NewRGBA(r)
-
-	isTrooper := false
-	isGrin := false
-	isSmallGrin := false
-	isDiscomfort := false
-	isBored := false
-	isBoredUnshaven := false
-	isPhenome := false
-	isHelmet := false
-	isJoint := false
-	isBackwardHat := false
-	isPlasmaVision := false
-	isSportShades := false
-
-	isLasers := false
-
-	isBandanaMouth := false
-	isDumbfounded := false
-	isRose := false
-	isTongue := false
-
-	isSakura := false
-	isFlameShades := false
-
-	isBeanie := false
-	isKnitBeanie := false
-	isSweatband := false
-	isBTCBallers := false
-	isBackwardBandana := false
-	isBandanaHead := false
-	isPanelHat := false
-	isBlondeBraids := false
-
-	isGeometricShades := false
-	isTheDonShades := false
-	isThickFrameShades := false
-	isThinShades := false
-	isOversized := false
-	isGlasses := false
-	isBigGlasses := false
-	isRobot := false
-
-	isDreadlocks := false
-	isMessyHair := false
-	isTwoToneBraids := false
-
-	isZippedPuffer := false
-
-	isGoggles := false
-	for _, trait := range m.Traits {
-
-		if trait.TraitValue == "ETH Lasers" {
-			isLasers = true
-		}
-
-		if trait.TraitValue == "Robot" {
-			isRobot = true
-		}
-
-		if strings.Contains(trait.TraitValue, "Goggles") {
-			isGoggles = true
-		}
-
-		if trait.TraitValue == "Two Tone Braids" {
-			isTwoToneBraids = true
-		}
-		if trait.TraitValue == "Dreadlocks" {
-			isDreadlocks = true
-		}
-		if trait.TraitValue == "Messy Hair" {
-			isMessyHair = true
-		}
-		if trait.TraitValue == "Blonde Braids" {
-			isBlondeBraids = true
-		}
-
-		if trait.TraitValue == "Trooper Hat" {
-			isTrooper = true
-		}
-		if strings.Contains(trait.TraitValue, "Grin") && trait.TraitValue != "Small Grin" {
-			isGrin = true
-		} else if trait.TraitValue == "Small Grin" {
-			isSmallGrin = true
-		}
-
-		if strings.Contains(trait.TraitValue, "Bored") && trait.TraitValue != "Bored Unshaven" && trait.TraitType == "Mouth" {
-			isBored = true
-		} else if trait.TraitValue == "Bored Unshaven" && trait.TraitType == "Mouth" {
-			isBoredUnshaven = true
-		}
-
-		if trait.TraitValue == "Phoneme Vuh" {
-			isPhenome = true
-		}
-
-		if trait.TraitValue == "Discomfort" {
-			isDiscomfort = true
-		}
-
-		if trait.TraitValue == "Army Helmet" {
-			isHelmet = true
-		}
-		if trait.TraitValue == "Bored Joint" {
-			isJoint = true
-		}
-		if trait.TraitValue == "Backwards Hat" {
-			isBackwardHat = true
-		}
-		if trait.TraitValue == "Plasma Vision" {
-			isPlasmaVision = true
-		}
-		if trait.TraitValue == "Flame Shades" {
-			isFlameShades = true
-		}
-		if trait.TraitValue == "Sport Shades" {
-			isSportShades = true
-		}
-		if trait.TraitValue == "The Don Shades" {
-			isTheDonShades = true
-		}
-		if trait.TraitValue == "Thick Frames" {
-			isThickFrameShades = true
-		}
-		if trait.TraitValue == "Thin Shades" {
-			isThinShades = true
-		}
-		if trait.TraitValue == "Oversized" {
-			isOversized = true
-		}
-		if trait.TraitValue == "Geometric Shades" {
-			isGeometricShades = true
-		}
-
-		if trait.TraitValue == "Bitcoin Ballers" {
-			isBTCBallers = true
-		}
-
-		if trait.TraitValue == "Backwards Bandana" {
-			isBackwardBandana = true
-		}
-
-		if trait.TraitValue == "Beanie" {
-			isBeanie = true
-		}
-
-		if trait.TraitValue == "Knit Beanie" {
-			isKnitBeanie = true
-		}
-
-		if trait.TraitValue == "Sweatband" {
-			isSweatband = true
-		}
-
-		if trait.TraitValue == "Zipped Puffer" {
-			isZippedPuffer = true
-		}
-
-		if trait.TraitValue == "Bandana" && trait.TraitType == "Head" {
-			isBandanaHead = true
-		}
-
-		if trait.TraitValue == "Bandana" && trait.TraitType == "Mouth" {
-			isBandanaMouth = true
-		}
-		if trait.TraitValue == "Dumbfounded" && trait.TraitType == "Mouth" {
-			isDumbfounded = true
-		}
-		if trait.TraitValue == "Rose" && trait.TraitType == "Mouth" {
-			isRose = true
-		}
-		if trait.TraitValue == "Tongue" && trait.TraitType == "Mouth" {
-			isTongue = true
-		}
-		if trait.TraitValue == "Sakura" && trait.TraitType == "Head" {
-			isSakura = true
-		}
-		if trait.TraitValue == "Panel Hat" && trait.TraitType == "Head" {
-			isPanelHat = true
-		}
+// resumeBuildGraph loads the build graph of the run being resumed and widens
+// it to the tokens of graph. Without one it returns graph.
+func resumeBuildGraph(path string, graph *abbc.BuildGraph) (*abbc.BuildGraph, error) {
+	resumed, err := abbc.LoadBuildGraph(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return graph, nil
 	}
-
-	if isFlameShades || isGeometricShades || isTheDonShades || isThickFrameShades || isThinShades || isSportShades || isOversized || isPlasmaVision || isBTCBallers {
-		isGlasses = true
+	if err != nil {
+		return nil, err
 	}
-
-	if isFlameShades || isOversized || isPlasmaVision || isBTCBallers {
-		isBigGlasses = true
+	if graph.From < resumed.From {
+		resumed.From = graph.From
 	}
-
-	var mouthImage image.Image
-	var headImage image.Image
-	var glassesImage image.Image
-
-	isBigHead := false
-	if isSakura || isMessyHair || isTwoToneBraids || isDreadlocks || isTrooper {
-		isBigHead = true
+	if graph.To > resumed.To {
+		resumed.To = graph.To
 	}
+	return resumed, nil
+}
 
-	for _, trait := range m.Traits {
-
-		if isTrooper && trait.TraitType == "Eyes" {
-			draw.Draw(newImage, r, g.SpecialImages["Trooper Hat Right"], image.Point{0, 0}, draw.Over)
-		}
-
-		if trait.TraitType == "Eyes" && isGlasses {
-			glassesImage = g.TraitMaps[trait.TraitType][trait.TraitValue].TraitImage
-
-			if isOversized && isBeanie {
-				glassesImage = g.SpecialImages["beanie-oversized-eyes"]
-			} else if isThickFrameShades && isBackwardBandana {
-				glassesImage = g.SpecialImages["backwards-bandana-thick-frame-glasses"]
-			} else if isOversized && isBlondeBraids {
-				glassesImage = g.SpecialImages["blonde-braids-oversized-glasses"]
-			}
-
-			draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Bored"].TraitImage, image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if trait.TraitType == "Head" {
-			headImage = g.TraitMaps[trait.TraitType][trait.TraitValue].TraitImage
-		}
-
-		if isBeanie && isOversized && trait.TraitType == "Head" {
-			headImage = g.SpecialImages["beanie-oversized-head"]
-			continue
-		}
-
-		if isRobot && isGoggles && trait.TraitType == "Head" {
-			headImage = g.SpecialImages["goggles-robot-head"]
-			draw.Draw(newImage, r, headImage, image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isBeanie && isOversized && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, headImage, image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if trait.TraitType == "Mouth" {
-			mouthImage = g.TraitMaps[trait.TraitType][trait.TraitValue].TraitImage
-			if isGlasses && !(isFlameShades && (isTrooper || isHelmet)) {
-				draw.Draw(newImage, r, glassesImage, image.Point{0, 0}, draw.Over)
-			}
-			if isBigHead {
-				draw.Draw(newImage, r, headImage, image.Point{0, 0}, draw.Over)
-			}
-
-			if isGlasses && isHelmet {
-				croppedHelmet, err := cutter.Crop(headImage, cutter.Config{
-					Width:   headImage.Bounds().Dx(),
-					Height:  550,
-					Options: cutter.Copy,
-				})
-				if err != nil {
-					log.Fatal(err)
-				}
-				draw.Draw(newImage, r, croppedHelmet, image.Point{0, 0}, draw.Over)
-			}
-
-			if isGlasses && isGoggles && !(isPlasmaVision || isFlameShades) {
-				croppedGoggles, err := cutter.Crop(headImage, cutter.Config{
-					Width:   535,
-					Height:  headImage.Bounds().Dy(),
-					Options: cutter.Copy,
-				})
-				if err != nil {
-					log.Fatal(err)
-				}
-				draw.Draw(newImage, r, croppedGoggles, image.Point{0, 0}, draw.Over)
-				if isOversized {
-					draw.Draw(newImage, r, g.SpecialImages["Oversized Goggle Line"], image.Point{0, 0}, draw.Over)
-				}
-			}
-
-			if isTrooper && isBandanaMouth {
-				draw.Draw(newImage, r, g.SpecialImages["Trooper Hat Bandana"], image.Point{0, 0}, draw.Over)
-				continue
-			}
-		}
-
-		if isSakura && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, mouthImage, image.Point{0, 0}, draw.Over)
-		}
-
-		if (isTwoToneBraids || isDreadlocks) && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, headImage, image.Point{0, 0}, draw.Over)
-		}
-
-		if (isTrooper || isBackwardHat) && isGrin && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.SpecialImages["Grin Left"], image.Point{0, 0}, draw.Over)
-		}
-
-		if (isTrooper || isBackwardHat) && isRose && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, mouthImage, image.Point{0, 0}, draw.Over)
-		}
-
-		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isBTCBallers && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.SpecialImages["BTC Ballers Top"], image.Point{0, 0}, draw.Over)
-		// }
-
-		if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isPlasmaVision && trait.TraitType == "Jewelry" {
-			if isBandanaMouth {
-				draw.Draw(newImage, r, g.SpecialImages["Plasma vision cut bottom"], image.Point{0, 0}, draw.Over)
-			} else {
-				draw.Draw(newImage, r, g.SpecialImages["Plasma vision"], image.Point{0, 0}, draw.Over)
-				if isDumbfounded {
-					draw.Draw(newImage, r, g.SpecialImages["Nostril"], image.Point{0, 0}, draw.Over)
-				}
-			}
-		}
-
-		// if (isHelmet) && isFlameShades && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Flame Shades"].TraitImage, image.Point{0, 0}, draw.Over)
-		// }
-
-		// if (isTrooper) && isFlameShades && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Flame Shades"].TraitImage, image.Point{0, 0}, draw.Over)
-		// }
-
-		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isSportShades && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.SpecialImages["Sport shades"], image.Point{0, 0}, draw.Over)
-		// }
-
-		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isFlameShades && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.SpecialImages["Flame shades"], image.Point{0, 0}, draw.Over)
-		// }
-
-		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isOversized && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Oversized"].TraitImage, image.Point{0, 0}, draw.Over)
-		// }
-
-		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isGeometricShades && trait.TraitType == "Jewelry" {
-		// 	draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Geometric Shades"].TraitImage, image.Point{0, 0}, draw.Over)
-		// }
-
-		if isHelmet && trait.TraitType == "Clothes" {
-			backgroundColor := newImage.At(500, 0)
-			maskImage := image.NewRGBA(image.Rect(280, 400, 350, 530))
-			draw.Draw(newImage, maskImage.Bounds(), &image.Uniform{backgroundColor}, image.ZP, draw.Src)
-		}
-
-		if isBackwardHat && isBandanaMouth && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.SpecialImages["Bandana Left"], image.Point{0, 0}, draw.Over)
-		}
-
-		if isPlasmaVision && isBandanaMouth && trait.TraitType == "Head" {
-			draw.Draw(newImage, r, g.SpecialImages["Plasma vision"], image.Point{0, 0}, draw.Over)
-		} else if isPlasmaVision && trait.TraitType == "Head" {
-			draw.Draw(newImage, r, g.SpecialImages["Plasma vision bottom"], image.Point{0, 0}, draw.Over)
-			if isDumbfounded && trait.TraitType == "Head" {
-				draw.Draw(newImage, r, g.SpecialImages["Nostril"], image.Point{0, 0}, draw.Over)
-			}
-		}
-
-		if isTrooper && isRose && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, mouthImage, image.Point{0, 0}, draw.Over)
-		}
-
-		if isFlameShades && (isTrooper || isHelmet) && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.TraitMaps["Eyes"]["Flame Shades"].TraitImage, image.Point{0, 0}, draw.Over)
-		}
-
-		if isPanelHat && isSportShades && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.TraitMaps["Head"]["Panel Hat"].TraitImage, image.Point{0, 0}, draw.Over)
-		}
-
-		if isZippedPuffer && isGrin && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["grin-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["grin-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isSmallGrin && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["small-grin-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["small-grin-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isRose && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["rose-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["rose-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isDiscomfort && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["discomfort-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["discomfort-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isBored && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["bored-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["bored-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isBoredUnshaven && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["bored-unshaven-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["bored-unshaven-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isPhenome && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["phenome-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["phenome-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isZippedPuffer && isTongue && trait.TraitType == "Mouth" {
-			mouthImage = g.SpecialImages["tongue-puffer-mouth"]
-			draw.Draw(newImage, r, g.SpecialImages["tongue-puffer-mouth"], image.Point{0, 0}, draw.Over)
-			continue
-		}
-
-		if isBackwardBandana && isGlasses && !isBigGlasses && trait.TraitType == "Jewelry" {
-			if isGeometricShades {
-				croppedGlasses, err := cutter.Crop(headImage, cutter.Config{
-					Width:   535,
-					Height:  headImage.Bounds().Dy(),
-					Options: cutter.Copy,
-				})
-				if err != nil {
-					log.Fatal(err)
-				}
-				draw.Draw(newImage, r, croppedGlasses, image.Point{0, 0}, draw.Over)
-			} else {
-				draw.Draw(newImage, r, headImage, image.Point{0, 0}, draw.Over)
-			}
-		}
-
-		if isRobot && (isKnitBeanie || isPanelHat) && trait.TraitType == "Jewelry" {
-			robotImage := g.TraitMaps["Eyes"]["Robot"].TraitImage
-			croppedRobot, err := cutter.Crop(robotImage, cutter.Config{
-				Mode:    cutter.TopLeft,
-				Anchor:  image.Point{855, 355},
-				Width:   50,
-				Height:  75,
-				Options: cutter.Copy,
-			})
-			if err != nil {
-				log.Fatal(err)
-			}
-			draw.Draw(newImage, r, croppedRobot, image.Point{0, 0}, draw.Over)
-		}
+type failure struct {
+	TokenID int      `json:"token_id"`
+	Traits  []string `json:"traits,omitempty"`
+	Error   string   `json:"error"`
+}
 
-		if isBackwardBandana && isRobot && trait.TraitType == "Jewelry" {
-			robotImage := g.TraitMaps["Eyes"]["Robot"].TraitImage
-			croppedRobot, err := cutter.Crop(robotImage, cutter.Config{
-				Width:   robotImage.Bounds().Dx(),
-				Height:  450,
-				Options: cutter.Copy,
-			})
-			if err != nil {
-				log.Fatal(err)
-			}
-			draw.Draw(newImage, r, croppedRobot, image.Point{0, 0}, draw.Over)
-		}
+// writeFailures writes the failed tokens sorted by token ID.
+func writeFailures(path string, failures []*abbc.TokenError) error {
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].TokenID < failures[j].TokenID
+	})
 
-		if isLasers && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.SpecialImages["Laser"], image.Point{0, 0}, draw.Over)
+	report := []failure{}
+	for _, tokenErr := range failures {
+		f := failure{
+			TokenID: tokenErr.TokenID,
+			Error:   tokenErr.Err.Error(),
 		}
-
-		if isJoint && trait.TraitType == "Jewelry" {
-			draw.Draw(newImage, r, g.SpecialImages["Joint Smoke"], image.Point{0, 0}, draw.Over)
+		for _, trait := range tokenErr.Traits {
+			f.Traits = append(f.Traits, trait.TraitType+"="+trait.TraitKey)
 		}
-
-		if trait.TraitValue == "__NONE__" {
-			continue
-		}
-
-		draw.Draw(newImage, r, g.TraitMaps[trait.TraitType][trait.TraitValue].TraitImage, image.Point{0, 0}, draw.Over)
-	}
-
-	newImagePath := fmt.Sprintf("./tokens/%d.png", m.TokenID)
-	newImageFile, err := os.Create(filepath.FromSlash(newImagePath))
-	if err != nil {
-		return fmt.Errorf("os.Create(%s) error: %w", newImagePath, err)
+		report = append(report, f)
 	}
-	defer newImageFile.Close()
 
-	err = png.Encode(newImageFile, newImage)
+	data, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-func main() {
-	// rand.Seed(time.Now().UTC().UnixNano())
-	// rand.Seed(int64(time.Now().Day()))
-	rand.Seed(int64(time.Now().Year()))
-
-	g, err := newGenerator("./traits")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = os.Mkdir(filepath.FromSlash("./tokens"), 0777)
-	if err != nil && !os.IsExist(err) {
-		log.Fatal(err)
-	}
-
-	count := 1000
-	bar := progressbar.Default(int64(count))
-	sem := make(chan struct{}, 1)
-	wg := &sync.WaitGroup{}
-	for i := 0; i < count; i++ {
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(i int) {
-
-			defer func() {
-				bar.Add(1)
-				wg.Done()
-				<-sem
-			}()
-
-			metadata, err := g.GenerateMetadata(i)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			err = g.GenerateImage(metadata)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-		}(i)
-	}
-	wg.Wait()
+	return os.WriteFile(path, append(data, '\n'), 0644)
 }
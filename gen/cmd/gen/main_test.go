@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"testing"
+
+	abbc "abbc/gen"
 )
 
 func BenchmarkGenerateMetadata(b *testing.B) {
-	g, err := newGenerator("../../images")
+	c, err := abbc.LoadConfig("../../abbc.yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	g, err := abbc.NewGenerator(c)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -19,3 +26,42 @@ func BenchmarkGenerateMetadata(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkRender renders one token per iteration from the decoded layers,
+// from the layers converted by abbc.NewLayer and with Background and Fur
+// composites cached.
+func BenchmarkRender(b *testing.B) {
+	b.Run("raw", func(b *testing.B) { benchmarkRender(b, true, nil) })
+	b.Run("layers", func(b *testing.B) { benchmarkRender(b, false, nil) })
+	b.Run("prefixes", func(b *testing.B) { benchmarkRender(b, false, abbc.NewPrefixCache(2, 512<<20)) })
+}
+
+func benchmarkRender(b *testing.B, rawLayers bool, prefixes *abbc.PrefixCache) {
+	c, err := abbc.LoadConfig("../../abbc.yml")
+	if err != nil {
+		b.Skip(err)
+	}
+	c.RawLayers = rawLayers
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		b.Skip(err)
+	}
+	g.Prefixes = prefixes
+
+	tokens := []*abbc.Metadata{}
+	for tokenID := 0; tokenID < 100; tokenID++ {
+		m, err := g.GenerateMetadata(tokenID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		tokens = append(tokens, m)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, err := g.Render(context.Background(), tokens[n%len(tokens)])
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
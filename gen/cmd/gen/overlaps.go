@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	abbc "abbc/gen"
+)
+
+// overlapsCommand ranks the pairs of trait values where the upper layer
+// covers most of the lower one, with the rules that already apply to them.
+func overlapsCommand(args []string) error {
+	flags := flag.NewFlagSet("overlaps", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	top := flags.Int("top", 40, "number of pairs to list")
+	skipTypes := flags.String("skip", "Background,Fur", "comma-separated trait types to leave out")
+	unhandled := flags.Bool("unhandled", false, "only list pairs no rule applies to")
+	flags.Parse(args)
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		return err
+	}
+
+	skip := map[string]bool{}
+	for _, traitType := range strings.Split(*skipTypes, ",") {
+		skip[strings.TrimSpace(traitType)] = true
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COVERED\t%\tLOWER\tUPPER\tRULES")
+	listed := 0
+	for _, o := range g.Overlaps(skip) {
+		if listed == *top {
+			break
+		}
+		rules, err := g.PairRules(context.Background(), o.Lower, o.Upper)
+		if err != nil {
+			return err
+		}
+		if *unhandled && len(rules) > 0 {
+			continue
+		}
+		handled := "-"
+		if len(rules) > 0 {
+			handled = strings.Join(rules, ", ")
+		}
+		fmt.Fprintf(w, "%d\t%.1f\t%s=%s\t%s=%s\t%s\n", o.Covered, o.Percent(),
+			o.Lower.TraitType, o.Lower.TraitValue, o.Upper.TraitType, o.Upper.TraitValue, handled)
+		listed++
+	}
+	return w.Flush()
+}
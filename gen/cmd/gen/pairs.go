@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	abbc "abbc/gen"
+)
+
+// pairsCommand writes, for every rule, the pairs of trait values it applies
+// to drawn with the rules next to the same pair simply layered, or with
+// --types a grid of every value of one type with every value of another.
+func pairsCommand(args []string) error {
+	flags := flag.NewFlagSet("pairs", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	baseTraits := flags.String("base", "", "traits to draw the pairs over, like \"Fur=Dark Brown,Background=Gray\"")
+	only := flags.String("rule", "", "only write the sheet of this rule")
+	types := flags.String("types", "", "two trait types to write a grid of instead, like \"Head,Eyes\"")
+	columns := flags.Int("columns", 6, "thumbnails per row of rule sheets")
+	cell := flags.Int("cell", 256, "thumbnail size in pixels")
+	dir := flags.String("dir", "", "directory to write the sheets to (default pairs in the output directory)")
+	flags.Parse(args)
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		return err
+	}
+	base, err := g.ParseTraits(*baseTraits)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = filepath.Join(c.Path(c.OutputDir), "pairs")
+	}
+	err = os.MkdirAll(*dir, 0777)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if *types != "" {
+		parts := strings.Split(*types, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("--types %q is not two trait types", *types)
+		}
+		grid, err := g.PairGrid(ctx, base, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), *cell)
+		if err != nil {
+			return err
+		}
+		return writeSheet(filepath.Join(*dir, strings.TrimSpace(parts[0])+"-"+strings.TrimSpace(parts[1])+".png"), grid)
+	}
+
+	pairs, err := g.RulePairs(ctx)
+	if err != nil {
+		return err
+	}
+	byRule := map[string][]abbc.RulePair{}
+	for _, pair := range pairs {
+		for _, name := range pair.Rules {
+			byRule[name] = append(byRule[name], pair)
+		}
+	}
+	names := []string{}
+	for name := range byRule {
+		if *only == "" || name == *only {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return fmt.Errorf("no pair of trait values fires %q on its own", *only)
+	}
+
+	// Keep the two renders of a pair on the same row.
+	if *columns%2 == 1 {
+		*columns++
+	}
+	for _, name := range names {
+		cells := []abbc.SheetCell{}
+		for _, pair := range byRule[name] {
+			pairCells, err := g.PairCells(ctx, base, pair)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			cells = append(cells, pairCells...)
+		}
+		err = writeSheet(filepath.Join(*dir, name+".png"), abbc.Grid(cells, *columns, *cell))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSheet(path string, sheet image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, sheet)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
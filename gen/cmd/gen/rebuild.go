@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	abbc "abbc/gen"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// rebuildCommand re-renders the tokens whose traits, image files or rules,
+// or the config shared by all tokens, changed since the build graph of the
+// last run was saved.
+func rebuildCommand(args []string) error {
+	flags := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	dryRun := flags.Bool("dry-run", false, "only report the tokens that changed")
+	keepGoing := flags.Bool("keep-going", false, "keep rebuilding after a token fails and write failures.json")
+	workers := flags.Int("workers", runtime.NumCPU(), "goroutines per pipeline stage")
+	flags.Parse(args)
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		return err
+	}
+	g.Prefixes = abbc.NewPrefixCache(2, 512<<20)
+
+	outputDir := c.Path(c.OutputDir)
+	graphPath := filepath.Join(outputDir, "build.json")
+	graph, err := abbc.LoadBuildGraph(graphPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no build graph in %s, run gen generate first", outputDir)
+	}
+	if err != nil {
+		return err
+	}
+	g.Seed = graph.Seed
+
+	changed, err := graph.Changed(g)
+	if err != nil {
+		return err
+	}
+	tokenIDs := []int{}
+	for tokenID := range changed {
+		tokenIDs = append(tokenIDs, tokenID)
+	}
+	sort.Ints(tokenIDs)
+	for _, tokenID := range tokenIDs {
+		fmt.Printf("token %d: %s\n", tokenID, changed[tokenID])
+	}
+	fmt.Printf("%d of %d tokens changed\n", len(changed), graph.To-graph.From)
+	if *dryRun || len(changed) == 0 {
+		return nil
+	}
+
+	skip := map[int]bool{}
+	for tokenID := graph.From; tokenID < graph.To; tokenID++ {
+		if changed[tokenID] == "" {
+			skip[tokenID] = true
+		}
+	}
+	graph.Forget(changed)
+
+	journal, err := abbc.CreateJournal(filepath.Join(outputDir, "journal.jsonl"), true)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	bar := progressbar.Default(int64(len(changed)))
+	p := &abbc.Pipeline{
+		Generator: g,
+		Sink: &rebuildSink{
+			dir:    outputDir,
+			plain:  &abbc.DirSink{Dir: outputDir, Journal: journal, Graph: graph},
+			traced: &abbc.DirSink{Dir: outputDir, Traces: true, Journal: journal, Graph: graph},
+		},
+		Workers:   *workers,
+		KeepGoing: *keepGoing,
+		Skip:      skip,
+		OnToken: func(tokenID int, err *abbc.TokenError) {
+			bar.Add(1)
+		},
+	}
+	failures := p.Run(context.Background(), graph.From, graph.To)
+	err = graph.Save(graphPath, g)
+	if err != nil {
+		return err
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	if !*keepGoing {
+		return failures[0]
+	}
+
+	reportPath := filepath.Join(outputDir, "failures.json")
+	err = writeFailures(reportPath, failures)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%d of %d tokens failed, see %s", len(failures), len(changed), reportPath)
+}
+
+// rebuildSink writes a token with its trace when it had a trace file, so
+// that gen explain does not read the trace of the token before the rebuild.
+type rebuildSink struct {
+	dir           string
+	plain, traced abbc.Sink
+}
+
+func (s *rebuildSink) Write(t *abbc.Token) error {
+	tracePath := filepath.Join(s.dir, fmt.Sprintf("%d.trace.json", t.Metadata.TokenID))
+	if _, err := os.Stat(tracePath); err == nil {
+		return s.traced.Write(t)
+	}
+	return s.plain.Write(t)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	abbc "abbc/gen"
+)
+
+// sheetCommand writes contact sheets with every value of a trait type drawn
+// over the same base traits.
+func sheetCommand(args []string) error {
+	flags := flag.NewFlagSet("sheet", flag.ExitOnError)
+	configPath := flags.String("config", "abbc.yml", "collection config file")
+	traitType := flags.String("type", "", "trait type to show every value of")
+	all := flags.Bool("all", false, "write one sheet per trait type")
+	baseTraits := flags.String("base", "", "traits to draw the values over, like \"Fur=Dark Brown,Background=Gray\"")
+	columns := flags.Int("columns", 6, "thumbnails per row")
+	cell := flags.Int("cell", 256, "thumbnail size in pixels")
+	dir := flags.String("dir", "", "directory to write {Type}.png to (default sheets in the output directory)")
+	flags.Parse(args)
+	if *traitType == "" && !*all {
+		return errors.New("pass --type or --all")
+	}
+
+	c, err := abbc.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	g, err := abbc.NewGenerator(c)
+	if err != nil {
+		return err
+	}
+	base, err := g.ParseTraits(*baseTraits)
+	if err != nil {
+		return err
+	}
+
+	traitTypes := c.Layers
+	if !*all {
+		traitTypes = nil
+		for _, layer := range c.Layers {
+			if strings.EqualFold(layer, *traitType) {
+				traitTypes = []string{layer}
+			}
+		}
+		if traitTypes == nil {
+			return fmt.Errorf("unknown trait type %q", *traitType)
+		}
+	}
+
+	if *dir == "" {
+		*dir = filepath.Join(c.Path(c.OutputDir), "sheets")
+	}
+	err = os.MkdirAll(*dir, 0777)
+	if err != nil {
+		return err
+	}
+	for _, traitType := range traitTypes {
+		sheet, err := g.Sheet(context.Background(), traitType, base, *columns, *cell)
+		if err != nil {
+			return fmt.Errorf("%s sheet: %w", traitType, err)
+		}
+		err = writeSheet(filepath.Join(*dir, traitType+".png"), sheet)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	abbc "abbc/gen"
+)
+
+// sizeSink passes tokens on to Sink and adds up the bytes of the images
+// written, by folder.
+type sizeSink struct {
+	abbc.Sink
+
+	mu    sync.Mutex
+	bytes map[string]int64
+}
+
+func (s *sizeSink) Write(t *abbc.Token) error {
+	err := s.Sink.Write(t)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bytes == nil {
+		s.bytes = make(map[string]int64)
+	}
+	s.bytes["tokens"] += int64(len(t.Encoded))
+	for _, v := range t.Variants {
+		s.bytes[v.Dir] += int64(len(v.Encoded))
+	}
+	return nil
+}
+
+// printSizes prints the total size of the images written and of each
+// folder, largest first.
+func (s *sizeSink) printSizes(w io.Writer) {
+	if len(s.bytes) == 0 {
+		return
+	}
+	dirs := []string{}
+	var total int64
+	for dir, n := range s.bytes {
+		dirs = append(dirs, dir)
+		total += n
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if s.bytes[dirs[i]] != s.bytes[dirs[j]] {
+			return s.bytes[dirs[i]] > s.bytes[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	parts := []string{}
+	for _, dir := range dirs {
+		parts = append(parts, fmt.Sprintf("%s %s", dir, formatBytes(s.bytes[dir])))
+	}
+	fmt.Fprintf(w, "wrote %s of images: %s\n", formatBytes(total), strings.Join(parts, ", "))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
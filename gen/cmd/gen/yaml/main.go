@@ -68,12 +68,22 @@ func GetTraits(traitType, path string) ([]TraitData, error) {
 }
 
 type Datum struct {
+	Key    string `yaml:"key"`
 	Name   string `yaml:"name"`
 	File   string `yaml:"file"`
 	Chance int    `yaml:"chance"`
 	Active bool   `yaml:"active"`
 }
 
+// traitKey turns a trait name into the stable key stored in abbc.yml,
+// for example "Baseball Jersey + Hoodie" becomes "baseball-jersey-hoodie".
+func traitKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(words, "-")
+}
+
 type YamlTraitData struct {
 	Values []Datum `yaml:"values"`
 }
@@ -97,7 +107,7 @@ func main() {
 		for _, trait := range traitMap {
 			fmt.Println(trait.TraitType, trait.TraitValue)
 			imagePath := fmt.Sprintf("traits/%s/%s.png", traitType, trait.TraitValue)
-			datum := Datum{trait.TraitValue, imagePath, trait.TraitProbability, true}
+			datum := Datum{traitKey(trait.TraitValue), trait.TraitValue, imagePath, trait.TraitProbability, true}
 
 			yamlTraitData, ok := d.Traits[trait.TraitType]
 			if !ok {
@@ -0,0 +1,462 @@
+package abbc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+)
+
+type YamlTraitData struct {
+	// Max makes the trait type multi-select: between Min and Max values are
+	// picked instead of exactly one.
+	Min    int     `yaml:"min,omitempty"`
+	Max    int     `yaml:"max,omitempty"`
+	Values []Datum `yaml:"values"`
+
+	// Remove and Weights are only used in overlays. Remove drops values of
+	// the base by key and Weights changes the chance of a value by key.
+	Remove  []string       `yaml:"remove,omitempty,flow"`
+	Weights map[string]int `yaml:"weights,omitempty"`
+}
+
+// RulesConfig switches rules in Render off or back on. Enable only
+// matters in overlays, where it turns a rule disabled by the base back on.
+type RulesConfig struct {
+	Disable []string `yaml:"disable,omitempty"`
+	Enable  []string `yaml:"enable,omitempty"`
+}
+
+// CutoutConfig turns on writing every token a second time without its
+// Background, into Dir under the output directory (default "cutouts").
+// With URI set, the metadata links the cutout as cutout_image.
+type CutoutConfig struct {
+	Dir string `yaml:"dir,omitempty"`
+	URI string `yaml:"uri,omitempty"`
+}
+
+// Config is a collection profile loaded from a yml file such as abbc.yml.
+// Trait files, the traits directory and the output directory are relative to
+// the directory holding the config file.
+//
+// A config naming a base is an overlay: it starts from the base config and
+// adds, replaces, removes or re-weights trait values and rules. The output
+// directory and image URIs are never inherited, so an overlay writes next to
+// itself.
+type Config struct {
+	Base       string                   `yaml:"base,omitempty"`
+	Name       string                   `yaml:"name,omitempty"`
+	Supply     int                      `yaml:"supply,omitempty"`
+	TraitsDir  string                   `yaml:"traits_dir,omitempty"`
+	OutputDir  string                   `yaml:"output_dir,omitempty"`
+	ImageURI   string                   `yaml:"image_uri,omitempty"`
+	Cutout     *CutoutConfig            `yaml:"cutout,omitempty"`
+	Animation  *AnimationConfig         `yaml:"animation,omitempty"`
+	Preview    *PreviewConfig           `yaml:"preview,omitempty"`
+	Encode     EncodeConfig             `yaml:"encode,omitempty"`
+	Rules      RulesConfig              `yaml:"rules,omitempty"`
+	Layers     []string                 `yaml:"layers,omitempty,flow"`
+	Mutations  []Mutation               `yaml:"mutations,omitempty"`
+	Visibility VisibilityConfig         `yaml:"visibility,omitempty"`
+	Layouts    []Layout                 `yaml:"layouts,omitempty"`
+	Traits     map[string]YamlTraitData `yaml:"traits"`
+
+	// Dir is the directory of the config file.
+	Dir string `yaml:"-"`
+
+	// RawLayers keeps trait and special images as decoded instead of
+	// converting them with NewLayer. It is only useful for comparing.
+	RawLayers bool `yaml:"-"`
+}
+
+// LoadConfig loads a config file and any bases it names, returning the
+// merged effective config.
+func LoadConfig(path string) (*Config, error) {
+	c, err := loadConfigFile(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Name == "" {
+		c.Name = "Anti Boring Boring Club"
+	}
+	if c.Supply == 0 {
+		c.Supply = 4444
+	}
+	if c.OutputDir == "" {
+		c.OutputDir = "tokens"
+	}
+	if c.Cutout != nil && c.Cutout.Dir == "" {
+		c.Cutout.Dir = "cutouts"
+	}
+	if c.Animation != nil && c.Animation.Dir == "" {
+		c.Animation.Dir = "animations"
+	}
+	if c.Preview != nil {
+		if c.Preview.Dir == "" {
+			c.Preview.Dir = "previews"
+		}
+		if c.Preview.Quality == 0 {
+			c.Preview.Quality = 85
+		}
+	}
+	if len(c.Layers) == 0 {
+		c.Layers = []string{"Background", "Fur", "Clothes", "Eyes", "Head", "Mouth", "Jewelry"}
+	}
+	for _, traitType := range c.Layers {
+		traitData := c.Traits[traitType]
+		if traitData.Min < 0 || traitData.Max < 0 || traitData.Min > traitData.Max {
+			return nil, fmt.Errorf("%s: min %d and max %d must satisfy 0 <= min <= max", traitType, traitData.Min, traitData.Max)
+		}
+	}
+	return c, nil
+}
+
+func loadConfigFile(path string, seen map[string]bool) (*Config, error) {
+	absPath, err := filepath.Abs(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	if seen[absPath] {
+		return nil, fmt.Errorf("config %s includes itself through base", path)
+	}
+	seen[absPath] = true
+
+	configFile, err := os.Open(absPath)
+	if err != nil {
+		return nil, err
+	}
+	defer configFile.Close()
+
+	c := &Config{}
+	decoder := yaml.NewDecoder(configFile)
+	err = decoder.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s error: %w", path, err)
+	}
+	c.Dir = filepath.Dir(absPath)
+	if c.Base == "" && c.TraitsDir == "" {
+		c.TraitsDir = "traits"
+	}
+
+	base := &Config{Dir: c.Dir}
+	if c.Base != "" {
+		base, err = loadConfigFile(c.Path(c.Base), seen)
+		if err != nil {
+			return nil, fmt.Errorf("base of %s: %w", path, err)
+		}
+		err = base.rebase(c.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged, err := base.merge(c)
+	if err != nil {
+		return nil, fmt.Errorf("merge %s error: %w", path, err)
+	}
+	return merged, nil
+}
+
+// Path resolves a path from the config against the config directory.
+func (c *Config) Path(path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// IsLayer reports whether traitType is drawn, and so picked, at all.
+func (c *Config) IsLayer(traitType string) bool {
+	for _, layer := range c.Layers {
+		if layer == traitType {
+			return true
+		}
+	}
+	return false
+}
+
+// rebase rewrites the relative paths of c so they are relative to dir.
+func (c *Config) rebase(dir string) error {
+	rel := func(path string) (string, error) {
+		if path == "" || filepath.IsAbs(filepath.FromSlash(path)) {
+			return path, nil
+		}
+		relPath, err := filepath.Rel(dir, c.Path(path))
+		if err != nil {
+			return "", err
+		}
+		return filepath.ToSlash(relPath), nil
+	}
+
+	var err error
+	c.TraitsDir, err = rel(c.TraitsDir)
+	if err != nil {
+		return err
+	}
+	c.OutputDir, err = rel(c.OutputDir)
+	if err != nil {
+		return err
+	}
+	for i := range c.Layouts {
+		c.Layouts[i].Font, err = rel(c.Layouts[i].Font)
+		if err != nil {
+			return err
+		}
+	}
+	for traitType, traitData := range c.Traits {
+		for i := range traitData.Values {
+			traitData.Values[i].File, err = rel(traitData.Values[i].File)
+			if err != nil {
+				return err
+			}
+			for j := range traitData.Values[i].Frames {
+				traitData.Values[i].Frames[j].File, err = rel(traitData.Values[i].Frames[j].File)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		c.Traits[traitType] = traitData
+	}
+	if c.Animation != nil {
+		for _, frames := range c.Animation.Specials {
+			for i := range frames {
+				frames[i].File, err = rel(frames[i].File)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	c.Dir = dir
+	return nil
+}
+
+// merge applies the overlay o on top of c and returns the result.
+func (c *Config) merge(o *Config) (*Config, error) {
+	merged := &Config{
+		Name:       c.Name,
+		Supply:     c.Supply,
+		TraitsDir:  c.TraitsDir,
+		OutputDir:  o.OutputDir,
+		ImageURI:   o.ImageURI,
+		Cutout:     o.Cutout,
+		Animation:  o.Animation,
+		Preview:    o.Preview,
+		Encode:     c.Encode,
+		Layers:     c.Layers,
+		Mutations:  append([]Mutation{}, c.Mutations...),
+		Visibility: c.Visibility,
+		Layouts:    c.Layouts,
+		Traits:     make(map[string]YamlTraitData),
+		Dir:        o.Dir,
+	}
+	if len(o.Layers) > 0 {
+		merged.Layers = o.Layers
+	}
+	if o.Name != "" {
+		merged.Name = o.Name
+	}
+	if o.Supply != 0 {
+		merged.Supply = o.Supply
+	}
+	if o.TraitsDir != "" {
+		merged.TraitsDir = o.TraitsDir
+	}
+	if o.Visibility != (VisibilityConfig{}) {
+		merged.Visibility = o.Visibility
+	}
+	if o.Encode != (EncodeConfig{}) {
+		merged.Encode = o.Encode
+	}
+	if len(o.Layouts) > 0 {
+		merged.Layouts = o.Layouts
+	}
+
+	enabled := make(map[string]bool)
+	for _, name := range o.Rules.Enable {
+		enabled[name] = true
+	}
+	disabled := make(map[string]bool)
+	for _, name := range append(c.Rules.Disable, o.Rules.Disable...) {
+		if enabled[name] || disabled[name] {
+			continue
+		}
+		disabled[name] = true
+		merged.Rules.Disable = append(merged.Rules.Disable, name)
+	}
+
+	for _, mutation := range o.Mutations {
+		replaced := false
+		for i := range merged.Mutations {
+			if merged.Mutations[i].Key == mutation.Key {
+				merged.Mutations[i] = mutation
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged.Mutations = append(merged.Mutations, mutation)
+		}
+	}
+
+	for traitType, traitData := range c.Traits {
+		merged.Traits[traitType] = YamlTraitData{
+			Min:    traitData.Min,
+			Max:    traitData.Max,
+			Values: append([]Datum{}, traitData.Values...),
+		}
+	}
+	for traitType, overlay := range o.Traits {
+		base := merged.Traits[traitType]
+		traitData, err := mergeValues(base.Values, overlay)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", traitType, err)
+		}
+		traitData.Min, traitData.Max = base.Min, base.Max
+		if overlay.Min != 0 {
+			traitData.Min = overlay.Min
+		}
+		if overlay.Max != 0 {
+			traitData.Max = overlay.Max
+		}
+		merged.Traits[traitType] = traitData
+	}
+	return merged, nil
+}
+
+func mergeValues(values []Datum, overlay YamlTraitData) (YamlTraitData, error) {
+	index := func(key string) int {
+		for i, datum := range values {
+			if datum.Key == key {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, key := range overlay.Remove {
+		i := index(key)
+		if i < 0 {
+			return YamlTraitData{}, fmt.Errorf("cannot remove unknown trait %q", key)
+		}
+		values = append(values[:i], values[i+1:]...)
+	}
+
+	for _, datum := range overlay.Values {
+		if i := index(datum.Key); i >= 0 && datum.Key != "" {
+			values[i] = datum
+		} else {
+			values = append(values, datum)
+		}
+	}
+
+	for key, chance := range overlay.Weights {
+		i := index(key)
+		if i < 0 {
+			return YamlTraitData{}, fmt.Errorf("cannot re-weight unknown trait %q", key)
+		}
+		values[i].Chance = chance
+	}
+
+	return YamlTraitData{Values: values}, nil
+}
+
+// A Datum is one value of a trait type. Rules match it by Key, and by Tags
+// for families of values: "glasses" for eyewear the head is drawn around,
+// "goggles" and "grin".
+type Datum struct {
+	Key         string   `yaml:"key"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Tags        []string `yaml:"tags,omitempty,flow"`
+	Rarity      string   `yaml:"rarity,omitempty"`
+	File        string   `yaml:"file"`
+	Chance      int      `yaml:"chance"`
+	Active      bool     `yaml:"active"`
+
+	// Frames animate the value in animated tokens. File is still drawn in
+	// the static token.
+	Frames []Frame `yaml:"frames,omitempty"`
+}
+
+func GetTraits(c *Config, wantedTraitType string) (map[string]TraitData, error) {
+	totalProbability := 0
+	traits := []TraitData{}
+
+	for traitType, traitData := range c.Traits {
+		// fmt.Println(traitType, traitData)
+		if traitType != wantedTraitType {
+			continue
+		}
+		for _, traitDatum := range traitData.Values {
+			// fmt.Println(traitType, traitDatum.Name)
+			if traitDatum.Key == "" {
+				return nil, fmt.Errorf("%s trait %q has no key", traitType, traitDatum.Name)
+			}
+			img, err := GetImage(c.Path(traitDatum.File))
+			if err != nil {
+				return nil, err
+			}
+			animation, err := loadAnimation(c, traitDatum.Frames)
+			if err != nil {
+				return nil, fmt.Errorf("%s trait %q frames: %w", traitType, traitDatum.Key, err)
+			}
+			totalProbability += traitDatum.Chance
+			traits = append(traits, TraitData{
+				TraitType:        traitType,
+				TraitKey:         traitDatum.Key,
+				TraitValue:       traitDatum.Name,
+				Description:      traitDatum.Description,
+				Tags:             traitDatum.Tags,
+				Rarity:           traitDatum.Rarity,
+				TraitProbability: traitDatum.Chance,
+				TraitImage:       img,
+				TraitFile:        traitDatum.File,
+				Animation:        animation,
+			})
+		}
+	}
+
+	traitMap := make(map[string]TraitData)
+	for _, trait := range traits {
+		if _, ok := traitMap[trait.TraitKey]; ok {
+			return nil, fmt.Errorf("%s trait key %q is used more than once", wantedTraitType, trait.TraitKey)
+		}
+		traitMap[trait.TraitKey] = trait
+	}
+
+	if totalProbability < 1000 {
+		traitMap[NoneKey] = TraitData{
+			TraitType:        wantedTraitType,
+			TraitKey:         NoneKey,
+			TraitValue:       NoneKey,
+			TraitProbability: 1000 - totalProbability,
+		}
+	}
+	return traitMap, nil
+}
+
+// PrintTraits writes a table of the values of each trait type with their
+// chances.
+func (g *Generator) PrintTraits(out io.Writer) {
+	for _, traitType := range g.Config.Layers {
+		fmt.Fprintln(out, traitType)
+		w := tabwriter.NewWriter(out, 1, 1, 1, ' ', 0)
+
+		totalProbability := 0
+		for _, traitData := range g.Config.Traits[traitType].Values {
+			trait := g.TraitMaps[traitType][traitData.Key]
+			totalProbability += trait.TraitProbability
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.01f%%\n", traitType, trait.TraitKey, trait.TraitValue, trait.Rarity, float64(trait.TraitProbability)/10)
+		}
+
+		fmt.Fprintf(w, "Total\t\t\tPercentage:\t%.01f%%\n", float64(totalProbability)/10)
+		w.Flush()
+		fmt.Fprintln(out)
+	}
+}
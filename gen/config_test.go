@@ -0,0 +1,117 @@
+package abbc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigOverlay(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("main/abbc.yml", `
+rules:
+  disable: [joint-smoke]
+traits:
+  Head:
+    values:
+    - {key: beanie, name: Beanie, file: traits/Head/Beanie.png, chance: 50, active: true}
+    - {key: army-helmet, name: Army Helmet, file: traits/Head/Army Helmet.png, chance: 20, active: true}
+`)
+	writeFile("holiday/holiday.yml", `
+base: ../main/abbc.yml
+name: ABBC Holiday
+rules:
+  enable: [joint-smoke]
+  disable: [eth-lasers]
+traits:
+  Head:
+    remove: [army-helmet]
+    weights:
+      beanie: 120
+    values:
+    - {key: santa-hat, name: Santa Hat, file: traits/Head/Santa Hat.png, chance: 40, active: true}
+`)
+
+	c, err := LoadConfig(filepath.Join(dir, "holiday", "holiday.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Name != "ABBC Holiday" {
+		t.Errorf("Name = %q", c.Name)
+	}
+	if got, want := c.Path(c.TraitsDir), filepath.Join(dir, "main", "traits"); got != want {
+		t.Errorf("traits dir = %s, want %s", got, want)
+	}
+	if got, want := c.Path(c.OutputDir), filepath.Join(dir, "holiday", "tokens"); got != want {
+		t.Errorf("output dir = %s, want %s", got, want)
+	}
+	if len(c.Rules.Disable) != 1 || c.Rules.Disable[0] != "eth-lasers" {
+		t.Errorf("Rules.Disable = %v", c.Rules.Disable)
+	}
+
+	values := c.Traits["Head"].Values
+	if len(values) != 2 {
+		t.Fatalf("got %d Head values, want 2", len(values))
+	}
+	if values[0].Key != "beanie" || values[0].Chance != 120 {
+		t.Errorf("values[0] = %+v", values[0])
+	}
+	if got, want := c.Path(values[0].File), filepath.Join(dir, "main", "traits", "Head", "Beanie.png"); got != want {
+		t.Errorf("beanie file = %s, want %s", got, want)
+	}
+	if got, want := c.Path(values[1].File), filepath.Join(dir, "holiday", "traits", "Head", "Santa Hat.png"); got != want {
+		t.Errorf("santa-hat file = %s, want %s", got, want)
+	}
+}
+
+func TestLoadConfigMinMax(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("abbc.yml", `
+traits:
+  Jewelry:
+    max: 3
+    values:
+    - {key: chain, name: Chain, file: traits/Jewelry/Chain.png, chance: 50, active: true}
+`)
+	writeFile("min.yml", `
+base: abbc.yml
+traits:
+  Jewelry:
+    min: 1
+`)
+	c, err := LoadConfig(filepath.Join(dir, "min.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Traits["Jewelry"]; got.Min != 1 || got.Max != 3 {
+		t.Errorf("Jewelry min %d max %d, want 1 and 3", got.Min, got.Max)
+	}
+
+	for name, data := range map[string]string{
+		"more.yml":     "base: abbc.yml\ntraits:\n  Jewelry:\n    min: 4\n",
+		"negative.yml": "base: abbc.yml\ntraits:\n  Jewelry:\n    max: -1\n",
+		"single.yml":   "traits:\n  Jewelry:\n    min: 1\n",
+	} {
+		writeFile(name, data)
+		if _, err := LoadConfig(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package abbc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Coverage counts how often every rule fired and every special image was
+// drawn over a run, keeping the lowest token IDs of each as examples.
+type Coverage struct {
+	// Examples is the number of token IDs kept per rule and special image.
+	Examples int
+
+	disabled map[string]bool
+	mu       sync.Mutex
+	tokens   int
+	rules    map[string]*CoverageCount
+	specials map[string]*CoverageCount
+}
+
+// A CoverageCount is the number of tokens a rule fired for or a special
+// image was drawn in.
+type CoverageCount struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Examples []int  `json:"examples,omitempty"`
+}
+
+// A CoverageReport lists every rule and special image with its count, in
+// the order they are defined, and those that never came up.
+type CoverageReport struct {
+	Tokens     int             `json:"tokens"`
+	Rules      []CoverageCount `json:"rules"`
+	Specials   []CoverageCount `json:"special_images"`
+	NeverFired []string        `json:"never_fired,omitempty"`
+	NeverDrawn []string        `json:"never_drawn,omitempty"`
+	Disabled   []string        `json:"disabled,omitempty"`
+}
+
+// NewCoverage returns an empty coverage for tokens rendered by g.
+func NewCoverage(g *Generator) *Coverage {
+	c := &Coverage{
+		Examples: 5,
+		disabled: g.DisabledRules,
+		rules:    make(map[string]*CoverageCount),
+		specials: make(map[string]*CoverageCount),
+	}
+	for _, rule := range Rules {
+		c.rules[rule.Name] = &CoverageCount{Name: rule.Name}
+	}
+	for _, special := range specialImages {
+		c.specials[special.name] = &CoverageCount{Name: special.name}
+	}
+	return c
+}
+
+// Add counts the rules and special images in the trace of t.
+func (c *Coverage) Add(t *Token) {
+	if t.Trace == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens++
+	for _, name := range t.Trace.Rules {
+		if !c.disabled[name] {
+			c.count(c.rules, name, t.Metadata.TokenID)
+		}
+	}
+	counted := map[string]bool{}
+	for _, step := range t.Trace.Steps {
+		name := strings.TrimPrefix(step.Image, "special:")
+		if name == step.Image || counted[name] {
+			continue
+		}
+		counted[name] = true
+		c.count(c.specials, name, t.Metadata.TokenID)
+	}
+}
+
+func (c *Coverage) count(counts map[string]*CoverageCount, name string, tokenID int) {
+	count := counts[name]
+	if count == nil {
+		count = &CoverageCount{Name: name}
+		counts[name] = count
+	}
+	count.Count++
+	i := sort.SearchInts(count.Examples, tokenID)
+	if i >= c.Examples {
+		return
+	}
+	count.Examples = append(count.Examples, 0)
+	copy(count.Examples[i+1:], count.Examples[i:])
+	count.Examples[i] = tokenID
+	if len(count.Examples) > c.Examples {
+		count.Examples = count.Examples[:c.Examples]
+	}
+}
+
+// Report returns the counts so far.
+func (c *Coverage) Report() *CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := &CoverageReport{Tokens: c.tokens}
+	for _, rule := range Rules {
+		count := *c.rules[rule.Name]
+		count.Examples = append([]int(nil), count.Examples...)
+		report.Rules = append(report.Rules, count)
+		if c.disabled[rule.Name] {
+			report.Disabled = append(report.Disabled, rule.Name)
+		} else if count.Count == 0 {
+			report.NeverFired = append(report.NeverFired, rule.Name)
+		}
+	}
+	for _, special := range specialImages {
+		count := *c.specials[special.name]
+		count.Examples = append([]int(nil), count.Examples...)
+		report.Specials = append(report.Specials, count)
+		if count.Count == 0 {
+			report.NeverDrawn = append(report.NeverDrawn, special.name)
+		}
+	}
+	return report
+}
@@ -0,0 +1,55 @@
+package abbc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	g := &Generator{DisabledRules: map[string]bool{"helmet-mask": true}}
+	c := NewCoverage(g)
+	c.Examples = 2
+	for _, tokenID := range []int{9, 4, 7, 1} {
+		c.Add(&Token{
+			Metadata: &Metadata{TokenID: tokenID},
+			Trace: &Trace{
+				Rules: []string{"puffer-grin", "helmet-mask"},
+				Steps: []Step{
+					{Op: StepDraw, Image: "Clothes=zipped-puffer"},
+					{Op: StepDraw, Image: "special:grin-puffer-mouth", Rule: "puffer-grin"},
+				},
+			},
+		})
+	}
+
+	report := c.Report()
+	if report.Tokens != 4 {
+		t.Errorf("%d tokens, want 4", report.Tokens)
+	}
+	for _, count := range report.Rules {
+		want := 0
+		if count.Name == "puffer-grin" {
+			want = 4
+			if !reflect.DeepEqual(count.Examples, []int{1, 4}) {
+				t.Errorf("puffer-grin examples %v, want [1 4]", count.Examples)
+			}
+		}
+		if count.Count != want {
+			t.Errorf("rule %s fired %d times, want %d", count.Name, count.Count, want)
+		}
+	}
+	for _, count := range report.Specials {
+		if count.Name == "grin-puffer-mouth" && count.Count != 4 {
+			t.Errorf("grin-puffer-mouth drawn %d times, want 4", count.Count)
+		}
+	}
+	if got, want := len(report.NeverFired), len(Rules)-2; got != want {
+		t.Errorf("%d rules never fired, want %d", got, want)
+	}
+	if got, want := len(report.NeverDrawn), len(specialImages)-1; got != want {
+		t.Errorf("%d special images never drawn, want %d", got, want)
+	}
+	if !reflect.DeepEqual(report.Disabled, []string{"helmet-mask"}) {
+		t.Errorf("disabled %v, want helmet-mask", report.Disabled)
+	}
+}
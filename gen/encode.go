@@ -0,0 +1,280 @@
+package abbc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// EncodeConfig sets how the PNGs of tokens and their variants are encoded.
+//
+// Compression is "default", "none", "speed" or "best". With Palette, images
+// of at most MaxColors colours (default 256) are written as paletted PNGs,
+// reduced to 256 colours by median cut when they have more. Images with
+// more colours stay full colour.
+type EncodeConfig struct {
+	Compression string `yaml:"compression,omitempty"`
+	Palette     bool   `yaml:"palette,omitempty"`
+	MaxColors   int    `yaml:"max_colors,omitempty"`
+}
+
+// PreviewConfig turns on writing a JPEG of every token at Quality (default
+// 85), scaled to Size pixels square unless 0, into Dir under the output
+// directory (default "previews").
+type PreviewConfig struct {
+	Dir     string `yaml:"dir,omitempty"`
+	Quality int    `yaml:"quality,omitempty"`
+	Size    int    `yaml:"size,omitempty"`
+}
+
+// An Encoder encodes token images as configured. It is safe for concurrent
+// use; all workers share its PNG buffers.
+type Encoder struct {
+	png       png.Encoder
+	palette   bool
+	maxColors int
+}
+
+// NewEncoder returns the encoder for c.
+func NewEncoder(c EncodeConfig) (*Encoder, error) {
+	e := &Encoder{png: png.Encoder{BufferPool: &bufferPool{}}, palette: c.Palette, maxColors: c.MaxColors}
+	switch c.Compression {
+	case "", "default":
+		e.png.CompressionLevel = png.DefaultCompression
+	case "none":
+		e.png.CompressionLevel = png.NoCompression
+	case "speed":
+		e.png.CompressionLevel = png.BestSpeed
+	case "best":
+		e.png.CompressionLevel = png.BestCompression
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c.Compression)
+	}
+	if e.maxColors == 0 {
+		e.maxColors = 256
+	}
+	if e.maxColors < 0 {
+		return nil, fmt.Errorf("max_colors %d is negative", c.MaxColors)
+	}
+	return e, nil
+}
+
+// bufferPool is a png.EncoderBufferPool.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func (p *bufferPool) Get() *png.EncoderBuffer {
+	b, _ := p.pool.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *bufferPool) Put(b *png.EncoderBuffer) {
+	p.pool.Put(b)
+}
+
+// PNG encodes img, paletted if the config allows.
+func (e *Encoder) PNG(img image.Image) ([]byte, error) {
+	if e.palette {
+		if paletted := quantize(img, e.maxColors); paletted != nil {
+			img = paletted
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := e.png.Encode(buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// JPEG encodes img at the given quality, scaled to size pixels square
+// unless size is 0.
+func JPEG(img image.Image, quality, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	if size > 0 && bounds.Dx() != size {
+		scaled := image.NewRGBA(image.Rect(0, 0, size, size))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, xdraw.Src, nil)
+		img = scaled
+	}
+	buf := &bytes.Buffer{}
+	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// quantize returns img with a palette of at most 256 colours, or nil if it
+// has more than maxColors colours. Up to 256 colours are kept exactly; more
+// are reduced by median cut.
+func quantize(img image.Image, maxColors int) *image.Paletted {
+	counts := map[color.NRGBA]int{}
+	if !countColors(counts, img, maxColors) {
+		return nil
+	}
+	p, index := medianCutPalette(counts)
+	return toPaletted(img, p, index)
+}
+
+// countColors adds the pixel counts of the colours of img to counts. It
+// reports false as soon as there are more than maxColors colours, unless
+// maxColors is 0.
+func countColors(counts map[color.NRGBA]int, img image.Image, maxColors int) bool {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)]++
+			if maxColors > 0 && len(counts) > maxColors {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// medianCutPalette returns a palette of at most 256 colours for counts and
+// the index in it of every counted colour.
+func medianCutPalette(counts map[color.NRGBA]int) (color.Palette, map[color.NRGBA]uint8) {
+	// Map order is random, so sort the colours to give the same palette
+	// for the same image on every run.
+	colors := make([]color.NRGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		return colorLess(colors[i], colors[j], 0)
+	})
+	boxes := medianCut(colors, counts, 256)
+
+	p := make(color.Palette, len(boxes))
+	index := make(map[color.NRGBA]uint8, len(colors))
+	for i, box := range boxes {
+		p[i] = box.average(counts)
+		for _, c := range box {
+			index[c] = uint8(i)
+		}
+	}
+	return p, index
+}
+
+// toPaletted returns img drawn with p, whose index holds every colour of
+// img.
+func toPaletted(img image.Image, p color.Palette, index map[color.NRGBA]uint8) *image.Paletted {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(bounds, p)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			paletted.SetColorIndex(x, y, index[color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)])
+		}
+	}
+	return paletted
+}
+
+// colorBox is a set of colours being split by median cut.
+type colorBox []color.NRGBA
+
+func channel(c color.NRGBA, i int) uint8 {
+	return [4]uint8{c.R, c.G, c.B, c.A}[i]
+}
+
+// colorLess orders colours by channel first, then by all channels in
+// turn, so that no two distinct colours compare equal.
+func colorLess(a, b color.NRGBA, first int) bool {
+	if ca, cb := channel(a, first), channel(b, first); ca != cb {
+		return ca < cb
+	}
+	for i := 0; i < 4; i++ {
+		if ca, cb := channel(a, i), channel(b, i); ca != cb {
+			return ca < cb
+		}
+	}
+	return false
+}
+
+// widest returns the channel with the largest range in the box and that
+// range.
+func (b colorBox) widest() (int, int) {
+	best, bestRange := 0, -1
+	for i := 0; i < 4; i++ {
+		lo, hi := 255, 0
+		for _, c := range b {
+			v := int(channel(c, i))
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > bestRange {
+			best, bestRange = i, hi-lo
+		}
+	}
+	return best, bestRange
+}
+
+// average returns the mean colour of the box weighted by pixel counts.
+func (b colorBox) average(counts map[color.NRGBA]int) color.NRGBA {
+	var sum [4]int
+	total := 0
+	for _, c := range b {
+		n := counts[c]
+		for i := range sum {
+			sum[i] += int(channel(c, i)) * n
+		}
+		total += n
+	}
+	return color.NRGBA{
+		uint8((sum[0] + total/2) / total),
+		uint8((sum[1] + total/2) / total),
+		uint8((sum[2] + total/2) / total),
+		uint8((sum[3] + total/2) / total),
+	}
+}
+
+// medianCut splits colors into at most n boxes, each time cutting the box
+// with the widest channel range at the pixel median of that channel.
+func medianCut(colors []color.NRGBA, counts map[color.NRGBA]int, n int) []colorBox {
+	boxes := []colorBox{colors}
+	for len(boxes) < n {
+		split, splitRange, splitChannel := -1, 0, 0
+		for i, box := range boxes {
+			if ch, r := box.widest(); r > splitRange {
+				split, splitRange, splitChannel = i, r, ch
+			}
+		}
+		if split < 0 {
+			break
+		}
+
+		box := boxes[split]
+		sort.SliceStable(box, func(i, j int) bool {
+			return colorLess(box[i], box[j], splitChannel)
+		})
+		total := 0
+		for _, c := range box {
+			total += counts[c]
+		}
+		// Cut where half the pixels are on each side, keeping both sides
+		// non-empty.
+		cut, seen := 1, 0
+		for i, c := range box[:len(box)-1] {
+			seen += counts[c]
+			cut = i + 1
+			if seen*2 >= total {
+				break
+			}
+		}
+		boxes[split] = box[:cut]
+		boxes = append(boxes, box[cut:])
+	}
+	return boxes
+}
@@ -0,0 +1,135 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+)
+
+// swatch returns a 64x64 image with the given number of colours.
+func swatch(levels int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := 0; i < 64*64; i++ {
+		v := i % levels
+		img.Set(i%64, i/64, color.RGBA{uint8(v), uint8(v >> 8 * 64), 255 - uint8(v), 255})
+	}
+	return img
+}
+
+func TestQuantize(t *testing.T) {
+	img := swatch(100)
+	paletted := quantize(img, 256)
+	if paletted == nil || len(paletted.Palette) != 100 {
+		t.Fatalf("100 colours did not keep an exact palette")
+	}
+	for i := 0; i < 64*64; i++ {
+		if got, want := color.RGBAModel.Convert(paletted.At(i%64, i/64)), img.At(i%64, i/64); got != want {
+			t.Fatalf("pixel %d is %v, want %v", i, got, want)
+		}
+	}
+
+	if paletted := quantize(swatch(1000), 256); paletted != nil {
+		t.Error("1000 colours quantized with max 256")
+	}
+	paletted = quantize(swatch(1000), 4096)
+	if paletted == nil || len(paletted.Palette) != 256 {
+		t.Fatal("1000 colours not cut down to 256")
+	}
+	r, _, _, _ := paletted.At(999%64, 999/64).RGBA()
+	if v := r >> 8; v < 999%256-8 || v > 999%256+8 {
+		t.Errorf("quantized red %d, want near %d", v, 999%256)
+	}
+}
+
+func TestEncoderPalette(t *testing.T) {
+	e, err := NewEncoder(EncodeConfig{Compression: "best", Palette: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := e.PNG(swatch(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*image.Paletted); !ok {
+		t.Errorf("decoded %T, want paletted", img)
+	}
+	if _, err := NewEncoder(EncodeConfig{Compression: "fast"}); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
+
+func TestEncoderDeterministic(t *testing.T) {
+	e, err := NewEncoder(EncodeConfig{Palette: true, MaxColors: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := swatch(1000)
+	first, err := e.PNG(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		data, err := e.PNG(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, first) {
+			t.Fatalf("encode %d differs from the first", i+2)
+		}
+	}
+}
+
+func TestTokenEncoding(t *testing.T) {
+	g := testPack(t, func(c *Config) {
+		c.Encode = EncodeConfig{Compression: "best", Palette: true, MaxColors: 4096}
+		c.Preview = &PreviewConfig{Dir: "previews", Quality: 70, Size: 128}
+	})
+	m, err := g.GenerateMetadata(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := g.Token(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	journal, err := CreateJournal(filepath.Join(dir, "journal.jsonl"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&DirSink{Dir: dir, Journal: journal}).Write(token); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	img, err := png.Decode(bytes.NewReader(token.Encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*image.Paletted); !ok {
+		t.Errorf("token decoded as %T, want paletted", img)
+	}
+	preview, err := GetImage(filepath.Join(dir, "previews", "2.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := preview.Bounds().Dx(); size != 128 {
+		t.Errorf("preview is %d pixels wide, want 128", size)
+	}
+
+	entries, err := ReadJournal(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !FinishedTokens(dir, entries, g.Seed, g.Config.VariantDirs())[2] {
+		t.Error("token with a preview not finished in the journal")
+	}
+}
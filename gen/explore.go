@@ -0,0 +1,134 @@
+package abbc
+
+import (
+	"context"
+	"image"
+)
+
+// A RulePair is two trait values of different types with rules that apply
+// to them together but to neither alone.
+type RulePair struct {
+	Lower, Upper MetadataTrait
+	Rules        []string
+}
+
+// RulePairs renders every pair of values of the types the rules look at
+// with all other layers empty and returns the pairs that fire a rule of
+// their own, in layer order.
+func (g *Generator) RulePairs(ctx context.Context) ([]RulePair, error) {
+	values := [][]MetadataTrait{}
+	solo := map[MetadataTrait][]string{}
+	for _, traitType := range g.Config.Layers {
+		if !ruleTraitTypes[traitType] {
+			continue
+		}
+		traits := []MetadataTrait{}
+		for _, key := range g.traitKeys(traitType) {
+			if key == NoneKey {
+				continue
+			}
+			trait := MetadataTrait{TraitType: traitType, TraitKey: key, TraitValue: g.TraitMaps[traitType][key].TraitValue}
+			_, trace, err := g.RenderTrace(ctx, g.layerMetadata([]MetadataTrait{trait}))
+			if err != nil {
+				return nil, err
+			}
+			solo[trait] = trace.Rules
+			traits = append(traits, trait)
+		}
+		values = append(values, traits)
+	}
+
+	pairs := []RulePair{}
+	for i, lowers := range values {
+		for _, uppers := range values[i+1:] {
+			for _, lower := range lowers {
+				for _, upper := range uppers {
+					rules, err := g.PairRules(ctx, lower, upper)
+					if err != nil {
+						return nil, err
+					}
+					own := []string{}
+					for _, name := range rules {
+						if !contains(solo[lower], name) && !contains(solo[upper], name) {
+							own = append(own, name)
+						}
+					}
+					if len(own) > 0 {
+						pairs = append(pairs, RulePair{Lower: lower, Upper: upper, Rules: own})
+					}
+				}
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// PairCells renders the pair over the base traits twice: as the rules draw
+// it, and with every rule switched off so that the layers are simply drawn
+// in order.
+func (g *Generator) PairCells(ctx context.Context, base []MetadataTrait, pair RulePair) ([]SheetCell, error) {
+	naive := *g
+	naive.Prefixes = nil
+	naive.DisabledRules = make(map[string]bool)
+	for _, rule := range Rules {
+		naive.DisabledRules[rule.Name] = true
+	}
+
+	m := g.layerMetadata(append(append([]MetadataTrait{}, base...), pair.Lower, pair.Upper))
+	label := pair.Lower.TraitValue + " + " + pair.Upper.TraitValue
+	cells := []SheetCell{}
+	for _, r := range []struct {
+		g    *Generator
+		what string
+	}{{g, "with rules"}, {&naive, "naive"}} {
+		img, err := r.g.Render(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, SheetCell{Image: img, Label: []string{label, r.what}})
+	}
+	return cells, nil
+}
+
+// PairGrid renders every value of rowType with every value of columnType
+// over the base traits, one row per value of rowType.
+func (g *Generator) PairGrid(ctx context.Context, base []MetadataTrait, rowType, columnType string, cell int) (*image.RGBA, error) {
+	rows, columns := g.traitKeys(rowType), g.traitKeys(columnType)
+	cells := []SheetCell{}
+	for _, row := range rows {
+		for _, column := range columns {
+			traits := append(append([]MetadataTrait{}, base...),
+				MetadataTrait{TraitType: rowType, TraitKey: row},
+				MetadataTrait{TraitType: columnType, TraitKey: column})
+			img, err := g.Render(ctx, g.layerMetadata(traits))
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, SheetCell{
+				Image: img,
+				Label: []string{g.traitLabel(rowType, row), g.traitLabel(columnType, column)},
+			})
+		}
+	}
+	return Grid(cells, len(columns), cell), nil
+}
+
+// traitKeys returns the keys of traitType in config order, followed by the
+// empty value if the type has one.
+func (g *Generator) traitKeys(traitType string) []string {
+	keys := []string{}
+	for _, datum := range g.Config.Traits[traitType].Values {
+		keys = append(keys, datum.Key)
+	}
+	if _, ok := g.TraitMaps[traitType][NoneKey]; ok {
+		keys = append(keys, NoneKey)
+	}
+	return keys
+}
+
+func (g *Generator) traitLabel(traitType, key string) string {
+	if key == NoneKey {
+		return "(none)"
+	}
+	return g.TraitMaps[traitType][key].TraitValue
+}
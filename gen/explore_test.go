@@ -0,0 +1,38 @@
+package abbc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRulePairs(t *testing.T) {
+	g := testPack(t, nil)
+
+	pairs, err := g.RulePairs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, pair := range pairs {
+		if pair.Lower.TraitKey == "thin-shades" && pair.Upper.TraitKey == "army-helmet" {
+			found = reflect.DeepEqual(pair.Rules, []string{"helmet-over-glasses"})
+		}
+		for _, name := range pair.Rules {
+			if name == "glasses-over-head" {
+				t.Errorf("%s + %s fires glasses-over-head, which thin shades fire alone", pair.Lower.TraitKey, pair.Upper.TraitKey)
+			}
+		}
+	}
+	if !found {
+		t.Error("army helmet over thin shades not found with only helmet-over-glasses")
+	}
+
+	cells, err := g.PairCells(context.Background(), nil, pairs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 2 {
+		t.Fatalf("%d cells, want the pair with and without rules", len(cells))
+	}
+}
@@ -0,0 +1,263 @@
+package abbc
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "image/png"
+
+	"github.com/mroth/weightedrand"
+)
+
+type Generator struct {
+	// Seed is the seed for picking traits. The same seed and config give
+	// the same tokens.
+	Seed int64
+
+	Config          *Config
+	DisabledRules   map[string]bool
+	MutationChooser *weightedrand.Chooser
+	TraitChoosers   map[string]*weightedrand.Chooser
+	TraitMaps       map[string]map[string]TraitData
+	SpecialImages   map[string]image.Image
+
+	// SpecialFiles are the paths of SpecialImages relative to the config
+	// directory.
+	SpecialFiles map[string]string
+
+	// SpecialAnimations are the frames of animated special images.
+	SpecialAnimations map[string]*Animation
+
+	// Prefixes caches composites of the first layers between tokens. It
+	// is off when nil.
+	Prefixes *PrefixCache
+
+	layouts []loadedLayout
+	encoder *Encoder
+	inputs  *inputHashes
+}
+
+// specialImages are the images in the Special directory of the traits that
+// the rules in Render draw, by name, with the trait type they stand in for.
+var specialImages = []struct {
+	name, file, traitType string
+}{
+	{"Grin Left", "Grin Left.png", "Mouth"},
+	{"Bandana Left", "Bandana Left.png", "Mouth"},
+	{"BTC Ballers Top", "BTC Ballers Top.png", "Eyes"},
+	{"Trooper Hat Right", "Trooper Hat Right.png", "Head"},
+	{"Joint Smoke", "Joint Smoke.png", "Mouth"},
+	{"Sport shades", "Sport shades cut bottom.png", "Eyes"},
+	{"Flame shades", "Flame shades cut bottom.png", "Eyes"},
+	{"Plasma vision cut bottom", "Plasma vision cut bottom.png", "Eyes"},
+	{"Plasma vision", "Plasma vision.png", "Eyes"},
+	{"Bitcoin ballers", "Bitcoin ballers cut bottom.png", "Eyes"},
+	{"Nostril", "Nostril.png", "Mouth"},
+	{"Plasma vision bottom", "Plasma vision bottom.png", "Eyes"},
+	{"Laser", "Laser.png", "Eyes"},
+	{"Oversized Goggle Line", "Oversized Goggle Line.png", "Head"},
+	{"Trooper Hat Bandana", "Trooper Hat Bandana.png", "Mouth"},
+	{"bored-puffer-mouth", "bored-puffer-mouth.png", "Mouth"},
+	{"bored-unshaven-puffer-mouth", "bored-unshaven-puffer-mouth.png", "Mouth"},
+	{"phenome-puffer-mouth", "phenome-puffer-mouth.png", "Mouth"},
+	{"tongue-puffer-mouth", "tongue-puffer-mouth.png", "Mouth"},
+	{"grin-puffer-mouth", "grin-puffer-mouth.png", "Mouth"},
+	{"small-grin-puffer-mouth", "small-grin-puffer-mouth.png", "Mouth"},
+	{"discomfort-puffer-mouth", "discomfort-puffer-mouth.png", "Mouth"},
+	{"rose-puffer-mouth", "rose-puffer-mouth.png", "Mouth"},
+	{"beanie-oversized-eyes", "beanie-oversized-eyes.png", "Eyes"},
+	{"beanie-oversized-head", "beanie-oversized-head.png", "Head"},
+	{"backwards-bandana-thick-frame-glasses", "backwards-bandana-thick-frame-glasses.png", "Eyes"},
+	{"goggles-robot-head", "goggles-robot-head.png", "Head"},
+	{"blonde-braids-oversized-glasses", "blonde-braids-oversized-glasses.png", "Eyes"},
+}
+
+func specialTraitType(name string) string {
+	for _, special := range specialImages {
+		if special.name == name {
+			return special.traitType
+		}
+	}
+	return ""
+}
+
+// SpecialImageFiles returns the names of the files NewGenerator loads from
+// the Special directory of the traits.
+func SpecialImageFiles() []string {
+	files := []string{}
+	for _, special := range specialImages {
+		files = append(files, special.file)
+	}
+	return files
+}
+
+func NewGenerator(c *Config) (*Generator, error) {
+	g := &Generator{
+		Config:        c,
+		DisabledRules: make(map[string]bool),
+		TraitMaps:     make(map[string]map[string]TraitData),
+		TraitChoosers: make(map[string]*weightedrand.Chooser),
+		SpecialImages: make(map[string]image.Image),
+		SpecialFiles:  make(map[string]string),
+		inputs:        &inputHashes{sums: make(map[string]string)},
+	}
+	for _, name := range c.Rules.Disable {
+		if !isRule(name) {
+			return nil, fmt.Errorf("unknown rule %q in config", name)
+		}
+		g.DisabledRules[name] = true
+	}
+	err := checkRuleLayers(c.Layers, g.DisabledRules)
+	if err != nil {
+		return nil, err
+	}
+
+	for traitType := range c.Traits {
+		if !c.IsLayer(traitType) {
+			return nil, fmt.Errorf("trait type %s is not in layers", traitType)
+		}
+	}
+
+	for _, trait := range c.Layers {
+		traitMap, err := GetTraits(c, trait)
+		if err != nil {
+			return nil, err
+		}
+		g.TraitMaps[trait] = traitMap
+
+		keys := make([]string, 0, len(traitMap))
+		for k := range traitMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		choices := []weightedrand.Choice{}
+		for _, k := range keys {
+			// fmt.Println(k)
+			choices = append(choices, weightedrand.Choice{
+				Item:   k,
+				Weight: uint(traitMap[k].TraitProbability),
+			})
+		}
+
+		chooser, err := weightedrand.NewChooser(choices...)
+		if err != nil {
+			return nil, err
+		}
+
+		g.TraitChoosers[trait] = chooser
+	}
+
+	mutationChooser, err := newMutationChooser(c.Mutations)
+	if err != nil {
+		return nil, err
+	}
+	g.MutationChooser = mutationChooser
+
+	for _, special := range specialImages {
+		file := path.Join(c.TraitsDir, "Special", special.file)
+		imagePath := c.Path(file)
+		img, err := GetImage(imagePath)
+		if err != nil {
+			return nil, fmt.Errorf("GetImage(%s) error: %w", imagePath, err)
+		}
+		g.SpecialImages[special.name] = img
+		g.SpecialFiles[special.name] = file
+	}
+
+	err = g.loadSpecialAnimations()
+	if err != nil {
+		return nil, err
+	}
+	if !c.RawLayers {
+		g.convertLayers()
+	}
+
+	err = g.loadLayouts()
+	if err != nil {
+		return nil, err
+	}
+	err = checkVariantDirs(c)
+	if err != nil {
+		return nil, err
+	}
+	g.encoder, err = NewEncoder(c.Encode)
+	if err != nil {
+		return nil, fmt.Errorf("encode: %w", err)
+	}
+	return g, nil
+}
+
+// convertLayers replaces every trait and special image with its NewLayer.
+func (g *Generator) convertLayers() {
+	for _, traitMap := range g.TraitMaps {
+		for key, trait := range traitMap {
+			if trait.TraitImage == nil {
+				continue
+			}
+			trait.TraitImage = NewLayer(trait.TraitImage)
+			if trait.Animation != nil {
+				trait.Animation.convert()
+			}
+			traitMap[key] = trait
+		}
+	}
+	for name, img := range g.SpecialImages {
+		g.SpecialImages[name] = NewLayer(img)
+	}
+	for _, a := range g.SpecialAnimations {
+		a.convert()
+	}
+}
+
+// GetImage decodes the image at path. The artwork was drawn on a case
+// insensitive file system, so when path does not exist a file differing only
+// in case is used instead.
+func GetImage(path string) (image.Image, error) {
+	path = filepath.FromSlash(path)
+	imageFile, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if match := findFold(path); match != "" {
+			imageFile, err = os.Open(match)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+	img, _, err := image.Decode(imageFile)
+	return img, err
+}
+
+// findFold returns the existing path that equals path apart from case, or ""
+// if there is none.
+func findFold(path string) string {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if _, err := os.Stat(dir); err != nil {
+		if dir == path || dir == filepath.Dir(dir) {
+			return ""
+		}
+		dir = findFold(dir)
+		if dir == "" {
+			return ""
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
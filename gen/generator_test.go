@@ -0,0 +1,51 @@
+package abbc
+
+import (
+	"testing"
+
+	"abbc/gen/abbctest"
+)
+
+// testPack returns a generator for the default abbctest pack, with its
+// config changed by edit first unless edit is nil.
+func testPack(tb testing.TB, edit func(c *Config)) *Generator {
+	tb.Helper()
+	configPath, err := abbctest.Write(tb.TempDir(), abbctest.Layers, abbctest.Traits, SpecialImageFiles())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	c, err := LoadConfig(configPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if edit != nil {
+		edit(c)
+	}
+	g, err := NewGenerator(c)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return g
+}
+
+func TestNewGenerator(t *testing.T) {
+	g := testPack(t, nil)
+
+	if got, want := len(g.Config.Layers), len(abbctest.Layers); got != want {
+		t.Fatalf("%d layers, want %d", got, want)
+	}
+	for traitType, keys := range abbctest.Traits {
+		for _, key := range keys {
+			trait, ok := g.TraitMaps[traitType][key]
+			if !ok || trait.TraitImage == nil {
+				t.Errorf("%s trait %s not loaded", traitType, key)
+			}
+		}
+		if _, ok := g.TraitMaps[traitType][NoneKey]; ok {
+			t.Errorf("%s has an empty value although its chances add up to 1000", traitType)
+		}
+	}
+	if got, want := len(g.SpecialImages), len(specialImages); got != want {
+		t.Errorf("%d special images, want %d", got, want)
+	}
+}
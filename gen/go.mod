@@ -5,8 +5,8 @@ go 1.17
 require (
 	github.com/goccy/go-yaml v1.9.5
 	github.com/mroth/weightedrand v0.4.1
-	github.com/oliamb/cutter v0.2.2
 	github.com/schollz/progressbar/v3 v3.8.6
+	golang.org/x/image v0.5.0
 )
 
 require (
@@ -20,5 +20,6 @@ require (
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e // indirect
 	golang.org/x/sys v0.0.0-20220727055044-e65921a090b8 // indirect
 	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467 // indirect
+	golang.org/x/text v0.7.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220609144429-65e65417b02f // indirect
 )
@@ -0,0 +1,211 @@
+package abbc
+
+import (
+	"context"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata/golden")
+
+// goldenCases are trait combinations covering every rule in Render. Types
+// left out use goldenBase.
+var goldenCases = []struct {
+	name   string
+	rule   string
+	traits map[string]string
+}{
+	{"plain", "", nil},
+	{"trooper-hat", "trooper-hat-right", map[string]string{"Head": "trooper-hat"}},
+	{"thin-shades", "glasses-over-head", map[string]string{"Eyes": "thin-shades"}},
+	{"beanie-oversized", "beanie-oversized", map[string]string{"Eyes": "oversized", "Head": "beanie"}},
+	{"backwards-bandana-thick-frames", "backwards-bandana-thick-frames", map[string]string{"Eyes": "thick-frames", "Head": "backwards-bandana"}},
+	{"blonde-braids-oversized", "blonde-braids-oversized", map[string]string{"Eyes": "oversized", "Head": "blonde-braids"}},
+	{"goggles-robot", "goggles-robot-head", map[string]string{"Eyes": "robot", "Head": "goggles"}},
+	{"messy-hair-thin-shades", "big-head-over-glasses", map[string]string{"Eyes": "thin-shades", "Head": "messy-hair"}},
+	{"army-helmet-thin-shades", "helmet-over-glasses", map[string]string{"Eyes": "thin-shades", "Head": "army-helmet"}},
+	{"goggles-thin-shades", "goggles-over-glasses", map[string]string{"Eyes": "thin-shades", "Head": "goggles"}},
+	{"goggles-oversized", "goggles-over-glasses", map[string]string{"Eyes": "oversized", "Head": "goggles"}},
+	{"trooper-hat-bandana", "trooper-hat-bandana", map[string]string{"Head": "trooper-hat", "Mouth": "bandana"}},
+	{"sakura", "sakura-mouth", map[string]string{"Head": "sakura"}},
+	{"dreadlocks", "braids-over-jewelry", map[string]string{"Head": "dreadlocks"}},
+	{"trooper-hat-grin", "grin-left", map[string]string{"Head": "trooper-hat", "Mouth": "grin"}},
+	{"backwards-hat-rose", "hat-rose", map[string]string{"Head": "backwards-hat", "Mouth": "rose"}},
+	{"backwards-hat-plasma-vision", "plasma-vision-over-hat", map[string]string{"Eyes": "plasma-vision", "Head": "backwards-hat"}},
+	{"bandana-plasma-vision-bandana", "plasma-vision-over-hat", map[string]string{"Eyes": "plasma-vision", "Head": "bandana", "Mouth": "bandana"}},
+	{"sweatband-plasma-vision-dumbfounded", "plasma-vision-over-hat", map[string]string{"Eyes": "plasma-vision", "Head": "sweatband", "Mouth": "dumbfounded"}},
+	{"army-helmet", "helmet-mask", map[string]string{"Head": "army-helmet"}},
+	{"backwards-hat-bandana", "bandana-left", map[string]string{"Head": "backwards-hat", "Mouth": "bandana"}},
+	{"plasma-vision", "plasma-vision-head", map[string]string{"Eyes": "plasma-vision"}},
+	{"plasma-vision-dumbfounded", "plasma-vision-head", map[string]string{"Eyes": "plasma-vision", "Mouth": "dumbfounded"}},
+	{"trooper-hat-rose", "trooper-rose", map[string]string{"Head": "trooper-hat", "Mouth": "rose"}},
+	{"army-helmet-flame-shades", "flame-shades-over-hat", map[string]string{"Eyes": "flame-shades", "Head": "army-helmet"}},
+	{"panel-hat-sport-shades", "panel-hat-sport-shades", map[string]string{"Eyes": "sport-shades", "Head": "panel-hat"}},
+	{"zipped-puffer-grin", "puffer-grin", map[string]string{"Clothes": "zipped-puffer", "Mouth": "grin-gold-grill"}},
+	{"zipped-puffer-small-grin", "puffer-small-grin", map[string]string{"Clothes": "zipped-puffer", "Mouth": "small-grin"}},
+	{"zipped-puffer-rose", "puffer-rose", map[string]string{"Clothes": "zipped-puffer", "Mouth": "rose"}},
+	{"zipped-puffer-discomfort", "puffer-discomfort", map[string]string{"Clothes": "zipped-puffer", "Mouth": "discomfort"}},
+	{"zipped-puffer-bored", "puffer-bored", map[string]string{"Clothes": "zipped-puffer", "Mouth": "bored"}},
+	{"zipped-puffer-bored-unshaven", "puffer-bored-unshaven", map[string]string{"Clothes": "zipped-puffer", "Mouth": "bored-unshaven"}},
+	{"zipped-puffer-phoneme-vuh", "puffer-phoneme-vuh", map[string]string{"Clothes": "zipped-puffer", "Mouth": "phoneme-vuh"}},
+	{"zipped-puffer-tongue", "puffer-tongue", map[string]string{"Clothes": "zipped-puffer", "Mouth": "tongue"}},
+	{"backwards-bandana-the-don-shades", "backwards-bandana-over-glasses", map[string]string{"Eyes": "the-don-shades", "Head": "backwards-bandana"}},
+	{"backwards-bandana-geometric-shades", "backwards-bandana-over-glasses", map[string]string{"Eyes": "geometric-shades", "Head": "backwards-bandana"}},
+	{"panel-hat-robot", "robot-hat-eye", map[string]string{"Eyes": "robot", "Head": "panel-hat"}},
+	{"backwards-bandana-robot", "backwards-bandana-robot", map[string]string{"Eyes": "robot", "Head": "backwards-bandana"}},
+	{"eth-lasers", "eth-lasers", map[string]string{"Eyes": "eth-lasers"}},
+	{"bored-joint", "joint-smoke", map[string]string{"Mouth": "bored-joint"}},
+}
+
+var goldenBase = map[string]string{
+	"Background": "gray",
+	"Fur":        "dark-brown",
+	"Clothes":    "hoodie",
+	"Eyes":       "sleepy",
+	"Head":       "flip-brim",
+	"Mouth":      "small-grin",
+	"Jewelry":    NoneKey,
+}
+
+// goldenScale is how much the goldens are scaled down, to keep testdata
+// small. Even the smallest rule, the robot eye, still covers a few hundred
+// pixels at this scale.
+const goldenScale = 4
+
+// TestGolden renders goldenCases from the collection artwork and compares
+// them with testdata/golden, which were rendered by the original
+// GenerateImage. Run it with -update to rewrite the goldens after an
+// intended change.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("renders the full artwork")
+	}
+	c, err := LoadConfig("abbc.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGenerator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	covered := map[string]bool{}
+	for _, tc := range goldenCases {
+		m := &Metadata{}
+		for _, traitType := range c.Layers {
+			traitKey, ok := tc.traits[traitType]
+			if !ok {
+				traitKey = goldenBase[traitType]
+			}
+			if _, ok := g.TraitMaps[traitType][traitKey]; !ok {
+				t.Fatalf("%s: no %s trait %q", tc.name, traitType, traitKey)
+			}
+			m.Traits = append(m.Traits, MetadataTrait{TraitType: traitType, TraitKey: traitKey})
+		}
+
+		rendered, trace, err := g.RenderTrace(context.Background(), m)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		img := shrink(rendered, goldenScale)
+		if tc.rule != "" && !contains(trace.Rules, tc.rule) {
+			t.Errorf("%s: rule %s did not apply, got %v", tc.name, tc.rule, trace.Rules)
+		}
+		covered[tc.rule] = true
+
+		goldenPath := filepath.Join("testdata", "golden", tc.name+".png")
+		if *update {
+			if err := writePNG(goldenPath, img); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		golden, err := GetImage(goldenPath)
+		if err != nil {
+			t.Errorf("%s: %v (run go test -run TestGolden -update)", tc.name, err)
+			continue
+		}
+		if n := pixelDiff(img, golden); n > img.Bounds().Dx()*img.Bounds().Dy()/1000 {
+			failedPath := filepath.Join(t.TempDir(), tc.name+".png")
+			writePNG(failedPath, img)
+			t.Errorf("%s: %d pixels differ from %s, got %s", tc.name, n, goldenPath, failedPath)
+		}
+	}
+
+	for _, rule := range Rules {
+		if !covered[rule.Name] {
+			t.Errorf("no golden case for rule %s", rule.Name)
+		}
+	}
+}
+
+// shrink scales img down by n, averaging each n×n block.
+func shrink(img image.Image, n int) *image.RGBA {
+	bounds := img.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/n, bounds.Dy()/n))
+	for y := 0; y < small.Rect.Dy(); y++ {
+		for x := 0; x < small.Rect.Dx(); x++ {
+			var sum [4]uint32
+			for dy := 0; dy < n; dy++ {
+				for dx := 0; dx < n; dx++ {
+					r, g, b, a := img.At(bounds.Min.X+x*n+dx, bounds.Min.Y+y*n+dy).RGBA()
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+r, sum[1]+g, sum[2]+b, sum[3]+a
+				}
+			}
+			i := small.PixOffset(x, y)
+			for c := range sum {
+				small.Pix[i+c] = uint8(sum[c] / uint32(n*n) >> 8)
+			}
+		}
+	}
+	return small
+}
+
+// pixelDiff returns the number of pixels where a and b differ by more than a
+// little in any channel. Pixels outside either image count as different.
+func pixelDiff(a, b image.Image) int {
+	const tolerance = 8 << 8
+	diff := 0
+	bounds := a.Bounds().Union(b.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := image.Pt(x, y)
+			if !p.In(a.Bounds()) || !p.In(b.Bounds()) {
+				diff++
+				continue
+			}
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if far(r1, r2, tolerance) || far(g1, g2, tolerance) || far(b1, b2, tolerance) || far(a1, a2, tolerance) {
+				diff++
+			}
+		}
+	}
+	return diff
+}
+
+func far(a, b, tolerance uint32) bool {
+	if a > b {
+		return a-b > tolerance
+	}
+	return b-a > tolerance
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package abbc
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// A JournalEntry records a token written by a DirSink with the seed it was
+// picked with and the SHA-256 of its files. Variants holds those of the
+// variant images by folder, and Dirs the variant folders of the config,
+// including those the token had no image for.
+type JournalEntry struct {
+	TokenID  int               `json:"token_id"`
+	Seed     int64             `json:"seed"`
+	PNG      string            `json:"png_sha256"`
+	JSON     string            `json:"json_sha256"`
+	Variants map[string]string `json:"variants,omitempty"`
+	Dirs     []string          `json:"variant_dirs,omitempty"`
+}
+
+// Journal is an append-only log of the tokens a DirSink has finished, one
+// JSON entry per line, so that an interrupted run can be resumed.
+type Journal struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// CreateJournal opens the journal at path. It is emptied unless resume is
+// set, in which case new entries are appended to the existing ones.
+func CreateJournal(path string, resume bool) (*Journal, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{f: f}, nil
+}
+
+// Add appends e to the journal.
+func (j *Journal) Add(e JournalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(line, '\n'))
+	return err
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// ReadJournal reads the entries of the journal at path. A missing journal
+// has no entries, and lines that do not parse, such as one cut off by a
+// crash, are skipped.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := JournalEntry{}
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// FinishedTokens returns the IDs of the journal entries written with seed
+// whose files in dir still have the recorded hashes. Tokens written before
+// one of variantDirs, the variant folders of the current config, was added
+// are not finished. When a token is in the journal more than once, the last
+// entry counts.
+func FinishedTokens(dir string, entries []JournalEntry, seed int64, variantDirs []string) map[int]bool {
+	last := make(map[int]JournalEntry)
+	for _, e := range entries {
+		last[e.TokenID] = e
+	}
+
+	finished := make(map[int]bool)
+	for tokenID, e := range last {
+		if e.Seed != seed {
+			continue
+		}
+		if fileHash(filepath.Join(dir, fmt.Sprintf("%d.png", tokenID))) != e.PNG {
+			continue
+		}
+		if fileHash(filepath.Join(dir, fmt.Sprintf("%d.json", tokenID))) != e.JSON {
+			continue
+		}
+		changed := false
+		for _, variantDir := range variantDirs {
+			if !contains(e.Dirs, variantDir) {
+				changed = true
+			} else if sum, ok := e.Variants[variantDir]; ok && !variantUnchanged(filepath.Join(dir, variantDir, strconv.Itoa(tokenID)), sum) {
+				changed = true
+			}
+		}
+		if changed {
+			continue
+		}
+		finished[tokenID] = true
+	}
+	return finished
+}
+
+// variantUnchanged reports whether the variant file at base plus one of the
+// variant extensions has the given hash.
+func variantUnchanged(base, sum string) bool {
+	for _, ext := range variantExts {
+		if fileHash(base+ext) == sum {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHash returns the hex SHA-256 of the file at path, or "" if it cannot
+// be read.
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return hash(data)
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFile writes data to a temporary file next to path and renames it
+// into place, so that path never holds a partly written file.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
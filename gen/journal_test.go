@@ -0,0 +1,72 @@
+package abbc
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	journal, err := CreateJournal(journalPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &DirSink{Dir: dir, Journal: journal}
+	for tokenID := 0; tokenID < 3; tokenID++ {
+		err := sink.Write(&Token{
+			Metadata: &Metadata{TokenID: tokenID},
+			JSON:     &TokenMetadata{},
+			Seed:     7,
+			Image:    image.NewRGBA(image.Rect(0, 0, 4, 4)),
+
+			VariantDirs: []string{"animations"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+
+	// A changed file and a line cut off by a crash.
+	err = os.WriteFile(filepath.Join(dir, "1.png"), []byte("half"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"token_id":3,"png_sha`)
+	f.Close()
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	// The tokens are still, so they have no file in animations.
+	finished := FinishedTokens(dir, entries, 7, []string{"animations"})
+	if want := map[int]bool{0: true, 2: true}; !reflect.DeepEqual(finished, want) {
+		t.Errorf("finished %v, want %v", finished, want)
+	}
+	if finished := FinishedTokens(dir, entries, 8, []string{"animations"}); len(finished) != 0 {
+		t.Errorf("finished %v with another seed", finished)
+	}
+	if finished := FinishedTokens(dir, entries, 7, []string{"animations", "cutouts"}); len(finished) != 0 {
+		t.Errorf("finished %v without the cutouts configured since", finished)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, ".*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -0,0 +1,75 @@
+package abbc
+
+import (
+	"image"
+	"image/draw"
+)
+
+// NewLayer converts img to premultiplied RGBA trimmed to the bounding box of
+// its non-transparent pixels. The layer keeps its place on the canvas: its
+// bounds are the trimmed rectangle, not a rectangle at the origin.
+//
+// Decoded PNGs are usually paletted or NRGBA, which image/draw composites on
+// its slow generic path. RGBA onto RGBA takes the fast path, and trimming
+// skips the mostly transparent rest of the canvas.
+func NewLayer(img image.Image) *image.RGBA {
+	full := image.NewRGBA(img.Bounds())
+	draw.Draw(full, full.Rect, img, full.Rect.Min, draw.Src)
+
+	bounds := opaqueBounds(full)
+	layer := image.NewRGBA(bounds)
+	draw.Draw(layer, bounds, full, bounds.Min, draw.Src)
+	return layer
+}
+
+// opaqueBounds returns the smallest rectangle holding every pixel of img
+// that is not fully transparent.
+func opaqueBounds(img *image.RGBA) image.Rectangle {
+	b := img.Rect
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X, b.Min.Y
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if row[(x-b.Min.X)*4+3] == 0 {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if x >= maxX {
+				maxX = x + 1
+			}
+			if y < minY {
+				minY = y
+			}
+			maxY = y + 1
+		}
+	}
+	if minX >= maxX {
+		return image.Rectangle{}
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// drawLayer draws layer over dst, touching only the layer's bounds.
+func drawLayer(dst *image.RGBA, layer image.Image) {
+	if layer == nil {
+		return
+	}
+	b := layer.Bounds()
+	draw.Draw(dst, b, layer, b.Min, draw.Over)
+}
+
+// cropLayer returns the part of layer inside r, in canvas coordinates. The
+// result shares pixels with layer.
+func cropLayer(layer image.Image, r image.Rectangle) image.Image {
+	r = r.Intersect(layer.Bounds())
+	if sub, ok := layer.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	cropped := image.NewRGBA(r)
+	draw.Draw(cropped, r, layer, r.Min, draw.Src)
+	return cropped
+}
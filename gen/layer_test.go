@@ -0,0 +1,41 @@
+package abbc
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestNewLayer(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	src.Set(10, 20, color.NRGBA{255, 0, 0, 128})
+	src.Set(30, 40, color.NRGBA{0, 0, 255, 255})
+
+	layer := NewLayer(src)
+	if want := image.Rect(10, 20, 31, 41); layer.Rect != want {
+		t.Errorf("bounds %v, want %v", layer.Rect, want)
+	}
+
+	background := &image.Uniform{color.RGBA{0, 128, 0, 255}}
+	want := image.NewRGBA(src.Rect)
+	draw.Draw(want, want.Rect, background, image.Point{}, draw.Src)
+	draw.Draw(want, want.Rect, src, image.Point{}, draw.Over)
+	got := image.NewRGBA(src.Rect)
+	draw.Draw(got, got.Rect, background, image.Point{}, draw.Src)
+	drawLayer(got, layer)
+	for i := range want.Pix {
+		if got.Pix[i] != want.Pix[i] {
+			t.Fatalf("pixel byte %d is %d, want %d", i, got.Pix[i], want.Pix[i])
+		}
+	}
+
+	cropped := cropLayer(layer, image.Rect(0, 0, 20, 64))
+	if want := image.Rect(10, 20, 20, 41); cropped.Bounds() != want {
+		t.Errorf("cropped bounds %v, want %v", cropped.Bounds(), want)
+	}
+
+	if empty := NewLayer(image.NewNRGBA(src.Rect)); !empty.Rect.Empty() {
+		t.Errorf("transparent image gave bounds %v", empty.Rect)
+	}
+}
@@ -0,0 +1,265 @@
+package abbc
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// A Layout places the token on a canvas of its own, such as a 1200x630
+// social card, a 1500x500 banner or a 1170x2532 phone wallpaper, with lines
+// of text next to it. The background of the token is continued over the rest
+// of the canvas. Every token is written once per layout, to Dir under the
+// output directory.
+type Layout struct {
+	Dir    string `yaml:"dir"`
+	Width  int    `yaml:"width"`
+	Height int    `yaml:"height"`
+
+	// Token is where the token goes. Size defaults to the shorter side of
+	// the canvas.
+	Token LayoutBox `yaml:"token,omitempty"`
+
+	// Anchor is the edge or corner of the canvas the token sits against,
+	// like "bottom" or "top-right", with Token.X and Token.Y moving it from
+	// there. The default is "top-left".
+	Anchor string `yaml:"anchor,omitempty"`
+
+	// Fill is "color" to continue the background colour of the token, the
+	// default, or "pattern" to repeat its whole Background.
+	Fill string `yaml:"fill,omitempty"`
+
+	// Font is a TrueType or OpenType file, relative to the config. The
+	// default is Go Bold.
+	Font string       `yaml:"font,omitempty"`
+	Text []LayoutText `yaml:"text,omitempty"`
+}
+
+// A LayoutBox is a square on a layout canvas.
+type LayoutBox struct {
+	X    int `yaml:"x"`
+	Y    int `yaml:"y"`
+	Size int `yaml:"size,omitempty"`
+}
+
+// LayoutText is a line of text on a layout. Text may use {name} for the
+// token name, {id} for the token number and {collection} for the collection
+// name. X is the left edge, the centre or the right edge of the line
+// depending on Align, and Y the baseline.
+type LayoutText struct {
+	Text  string  `yaml:"text"`
+	X     int     `yaml:"x"`
+	Y     int     `yaml:"y"`
+	Size  float64 `yaml:"size"`
+	Color string  `yaml:"color,omitempty"`
+	Align string  `yaml:"align,omitempty"`
+}
+
+// loadedLayout is the font and the text colours of a layout.
+type loadedLayout struct {
+	font     *opentype.Font
+	fontHash string
+	colors   []color.Color
+}
+
+// loadLayouts checks the layouts of the config and parses their fonts and
+// colours.
+func (g *Generator) loadLayouts() error {
+	var goBold *opentype.Font
+	for i, layout := range g.Config.Layouts {
+		if layout.Dir == "" || layout.Width <= 0 || layout.Height <= 0 {
+			return fmt.Errorf("layout %d needs a dir, width and height", i+1)
+		}
+		if _, err := anchorBox(layout.Anchor, image.Rect(0, 0, layout.Width, layout.Height), 0); err != nil {
+			return fmt.Errorf("layout %s: %w", layout.Dir, err)
+		}
+		switch layout.Fill {
+		case "", "color", "pattern":
+		default:
+			return fmt.Errorf("layout %s: unknown fill %q", layout.Dir, layout.Fill)
+		}
+
+		var f *opentype.Font
+		var fontHash string
+		var err error
+		if layout.Font != "" {
+			data, readErr := os.ReadFile(g.Config.Path(layout.Font))
+			if readErr != nil {
+				return fmt.Errorf("layout %s font: %w", layout.Dir, readErr)
+			}
+			f, err = opentype.Parse(data)
+			fontHash = hash(data)
+		} else {
+			if goBold == nil {
+				goBold, err = opentype.Parse(gobold.TTF)
+			}
+			f = goBold
+		}
+		if err != nil {
+			return fmt.Errorf("layout %s font: %w", layout.Dir, err)
+		}
+
+		loaded := loadedLayout{font: f, fontHash: fontHash}
+		for _, text := range layout.Text {
+			c, err := parseColor(text.Color)
+			if err != nil {
+				return fmt.Errorf("layout %s text %q: %w", layout.Dir, text.Text, err)
+			}
+			switch text.Align {
+			case "", "left", "center", "right":
+			default:
+				return fmt.Errorf("layout %s text %q: unknown align %q", layout.Dir, text.Text, text.Align)
+			}
+			if text.Size <= 0 {
+				return fmt.Errorf("layout %s text %q needs a size", layout.Dir, text.Text)
+			}
+			loaded.colors = append(loaded.colors, c)
+		}
+		g.layouts = append(g.layouts, loaded)
+	}
+	return nil
+}
+
+// parseColor parses "#rrggbb" or "#rrggbbaa". The default is white.
+func parseColor(s string) (color.Color, error) {
+	if s == "" {
+		return color.White, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return nil, fmt.Errorf("color %q is not #rrggbb or #rrggbbaa", s)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// anchorBox returns the square of the given size against the edge or corner
+// of r named by anchor.
+func anchorBox(anchor string, r image.Rectangle, size int) (image.Rectangle, error) {
+	if anchor == "" {
+		anchor = "top-left"
+	}
+	// Sides that are not named stay centred.
+	x := r.Min.X + (r.Dx()-size)/2
+	y := r.Min.Y + (r.Dy()-size)/2
+	for _, side := range strings.Split(anchor, "-") {
+		switch side {
+		case "top":
+			y = r.Min.Y
+		case "bottom":
+			y = r.Max.Y - size
+		case "left":
+			x = r.Min.X
+		case "right":
+			x = r.Max.X - size
+		case "center":
+		default:
+			return image.Rectangle{}, fmt.Errorf("unknown anchor %q", anchor)
+		}
+	}
+	return image.Rect(x, y, x+size, y+size), nil
+}
+
+// RenderLayout places the rendered token img of m on the canvas of the
+// layout with the given index in the config.
+func (g *Generator) RenderLayout(ctx context.Context, m *Metadata, img image.Image, index int) (*image.RGBA, error) {
+	layout := g.Config.Layouts[index]
+	loaded := g.layouts[index]
+
+	canvas := image.NewRGBA(image.Rect(0, 0, layout.Width, layout.Height))
+	size := layout.Token.Size
+	if size == 0 {
+		size = layout.Width
+		if layout.Height < size {
+			size = layout.Height
+		}
+	}
+	box, err := anchorBox(layout.Anchor, canvas.Bounds(), size)
+	if err != nil {
+		return nil, err
+	}
+	box = box.Add(image.Pt(layout.Token.X, layout.Token.Y))
+
+	bounds := img.Bounds()
+	if layout.Fill == "pattern" {
+		err = g.fillPattern(ctx, canvas, m, box)
+		if err != nil {
+			return nil, fmt.Errorf("layout %s: %w", layout.Dir, err)
+		}
+	} else {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(img.At(bounds.Min.X, bounds.Min.Y)), image.Point{}, draw.Src)
+	}
+
+	if box.Size() == bounds.Size() {
+		draw.Draw(canvas, box, img, bounds.Min, draw.Over)
+	} else {
+		xdraw.CatmullRom.Scale(canvas, box, img, bounds, xdraw.Over, nil)
+	}
+
+	replacer := strings.NewReplacer(
+		"{name}", g.TokenMetadata(m).Name,
+		"{id}", strconv.Itoa(m.TokenID),
+		"{collection}", g.Config.Name,
+	)
+	for i, text := range layout.Text {
+		face, err := opentype.NewFace(loaded.font, &opentype.FaceOptions{Size: text.Size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, fmt.Errorf("layout %s: %w", layout.Dir, err)
+		}
+		d := &font.Drawer{Dst: canvas, Src: image.NewUniform(loaded.colors[i]), Face: face}
+		line := replacer.Replace(text.Text)
+		x := fixed.I(text.X)
+		switch text.Align {
+		case "center":
+			x -= d.MeasureString(line) / 2
+		case "right":
+			x -= d.MeasureString(line)
+		}
+		d.Dot = fixed.Point26_6{X: x, Y: fixed.I(text.Y)}
+		d.DrawString(line)
+		face.Close()
+	}
+	return canvas, nil
+}
+
+// fillPattern repeats the Background of m, with its mutation, over canvas in
+// tiles the size of box and lined up with it.
+func (g *Generator) fillPattern(ctx context.Context, canvas *image.RGBA, m *Metadata, box image.Rectangle) error {
+	background := &Metadata{TokenID: m.TokenID, Mutation: m.Mutation}
+	for _, trait := range m.Traits {
+		if trait.TraitType != "Background" {
+			trait = MetadataTrait{TraitType: trait.TraitType, TraitKey: NoneKey}
+		}
+		background.Traits = append(background.Traits, trait)
+	}
+	img, err := g.Render(ctx, background)
+	if err != nil {
+		return err
+	}
+	tile := image.NewRGBA(image.Rect(0, 0, box.Dx(), box.Dy()))
+	xdraw.CatmullRom.Scale(tile, tile.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+
+	r := canvas.Bounds()
+	x0 := box.Min.X - (box.Min.X-r.Min.X+box.Dx()-1)/box.Dx()*box.Dx()
+	y0 := box.Min.Y - (box.Min.Y-r.Min.Y+box.Dy()-1)/box.Dy()*box.Dy()
+	for y := y0; y < r.Max.Y; y += box.Dy() {
+		for x := x0; x < r.Max.X; x += box.Dx() {
+			draw.Draw(canvas, image.Rect(x, y, x+box.Dx(), y+box.Dy()), tile, image.Point{}, draw.Src)
+		}
+	}
+	return nil
+}
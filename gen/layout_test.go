@@ -0,0 +1,116 @@
+package abbc
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestAnchorBox(t *testing.T) {
+	r := image.Rect(0, 0, 1170, 2532)
+	for _, tc := range []struct {
+		anchor string
+		want   image.Rectangle
+	}{
+		{"", image.Rect(0, 0, 1000, 1000)},
+		{"top-left", image.Rect(0, 0, 1000, 1000)},
+		{"bottom", image.Rect(85, 1532, 1085, 2532)},
+		{"center", image.Rect(85, 766, 1085, 1766)},
+		{"bottom-right", image.Rect(170, 1532, 1170, 2532)},
+		{"right", image.Rect(170, 766, 1170, 1766)},
+	} {
+		got, err := anchorBox(tc.anchor, r, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("anchor %q: got %v, want %v", tc.anchor, got, tc.want)
+		}
+	}
+	if _, err := anchorBox("middle", r, 1000); err == nil {
+		t.Error("unknown anchor accepted")
+	}
+}
+
+func TestLoadLayouts(t *testing.T) {
+	text := func(color, align string, size float64) []LayoutText {
+		return []LayoutText{{Text: "#{id}", Size: size, Color: color, Align: align}}
+	}
+	for _, tc := range []struct {
+		name   string
+		layout Layout
+		ok     bool
+	}{
+		{"card", Layout{Dir: "cards", Width: 1200, Height: 630, Text: text("#000000", "center", 96)}, true},
+		{"no dir", Layout{Width: 1200, Height: 630}, false},
+		{"no height", Layout{Dir: "cards", Width: 1200}, false},
+		{"anchor", Layout{Dir: "cards", Width: 1200, Height: 630, Anchor: "middle"}, false},
+		{"fill", Layout{Dir: "cards", Width: 1200, Height: 630, Fill: "gradient"}, false},
+		{"font", Layout{Dir: "cards", Width: 1200, Height: 630, Font: "missing.ttf"}, false},
+		{"colour name", Layout{Dir: "cards", Width: 1200, Height: 630, Text: text("black", "", 96)}, false},
+		{"align", Layout{Dir: "cards", Width: 1200, Height: 630, Text: text("", "justify", 96)}, false},
+		{"text size", Layout{Dir: "cards", Width: 1200, Height: 630, Text: text("", "", 0)}, false},
+	} {
+		g := &Generator{Config: &Config{Dir: t.TempDir(), Layouts: []Layout{tc.layout}}}
+		if err := g.loadLayouts(); (err == nil) != tc.ok {
+			t.Errorf("%s: error %v", tc.name, err)
+		}
+	}
+}
+
+func TestRenderLayout(t *testing.T) {
+	g := testPack(t, func(c *Config) {
+		c.Layouts = []Layout{
+			{
+				Dir:    "cards",
+				Width:  1200,
+				Height: 630,
+				Token:  LayoutBox{X: 570},
+				Text:   []LayoutText{{Text: "#{id}", X: 60, Y: 300, Size: 96, Color: "#000000"}},
+			},
+			{Dir: "wallpapers", Width: 117, Height: 253, Anchor: "bottom", Fill: "pattern"},
+		}
+	})
+	m, err := g.GenerateMetadata(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := g.Render(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, err := g.RenderLayout(context.Background(), m, img, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := card.Bounds().Size(); got != image.Pt(1200, 630) {
+		t.Errorf("card is %v", got)
+	}
+	if got, want := card.At(1199, 629), img.At(0, 0); got != want {
+		t.Errorf("card corner %v, want the token background %v", got, want)
+	}
+	black := false
+	for x := 60; x < 200 && !black; x++ {
+		for y := 220; y < 300 && !black; y++ {
+			r, g, b, _ := card.At(x, y).RGBA()
+			black = r == 0 && g == 0 && b == 0
+		}
+	}
+	if !black {
+		t.Error("no text drawn")
+	}
+
+	// A pattern fill repeats the token background around a token at the
+	// bottom of a wallpaper, so a tile starts one token size above it. Pack
+	// backgrounds only cover the top left corner of the canvas, and other
+	// layers cover the corner of the token itself.
+	wallpaper, err := g.RenderLayout(context.Background(), m, img, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	background := g.TraitMaps["Background"][m.Traits[0].TraitKey].TraitImage
+	if got, want := wallpaper.At(0, 253-2*117), background.At(0, 0); got != want {
+		t.Errorf("wallpaper tile corner %v, want the background %v", got, want)
+	}
+}
@@ -1 +1,141 @@
 package abbc
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// MetadataTrait is one trait of a token. Rendering matches on TraitKey and
+// the metadata JSON shows TraitValue.
+type MetadataTrait struct {
+	TraitType  string
+	TraitKey   string
+	TraitValue string
+}
+
+type Metadata struct {
+	TokenID  int
+	Traits   []MetadataTrait
+	Mutation string
+
+	// Attempt counts how often the traits were picked again because one of
+	// them was hidden.
+	Attempt int
+}
+
+// GenerateMetadata picks the traits of a token. The picks only depend on
+// g.Seed and tokenID, so tokens can be generated in any order.
+func (g *Generator) GenerateMetadata(tokenID int) (*Metadata, error) {
+	return g.generateMetadata(tokenID, 0)
+}
+
+// Reroll picks the traits of the token of m again.
+func (g *Generator) Reroll(m *Metadata) (*Metadata, error) {
+	return g.generateMetadata(m.TokenID, m.Attempt+1)
+}
+
+func (g *Generator) generateMetadata(tokenID, attempt int) (*Metadata, error) {
+	rs := rand.New(rand.NewSource(g.Seed + int64(tokenID)*0x9e3779b9 + int64(attempt)*0x7f4a7c15))
+	m := &Metadata{
+		TokenID: tokenID,
+		Attempt: attempt,
+	}
+	for _, trait := range g.Config.Layers {
+		traitKeys := []string{}
+		if g.Config.Traits[trait].Max > 0 {
+			keys, err := g.GetRandomTraits(rs, trait)
+			if err != nil {
+				return nil, err
+			}
+			traitKeys = append(traitKeys, keys...)
+		} else {
+			traitKey, err := g.GetRandomTrait(rs, trait)
+			if err != nil {
+				return nil, err
+			}
+			traitKeys = append(traitKeys, traitKey)
+		}
+
+		for _, traitKey := range traitKeys {
+			m.Traits = append(m.Traits, MetadataTrait{
+				TraitType:  trait,
+				TraitKey:   traitKey,
+				TraitValue: g.TraitMaps[trait][traitKey].TraitValue,
+			})
+		}
+	}
+	m.Mutation = g.GetRandomMutation(rs)
+	return m, nil
+}
+
+type Attribute struct {
+	TraitType string      `json:"trait_type"`
+	Value     interface{} `json:"value"`
+}
+
+// TokenMetadata is the metadata JSON of a token.
+type TokenMetadata struct {
+	Name         string      `json:"name"`
+	Image        string      `json:"image,omitempty"`
+	CutoutImage  string      `json:"cutout_image,omitempty"`
+	AnimationURL string      `json:"animation_url,omitempty"`
+	Attributes   []Attribute `json:"attributes"`
+}
+
+// tokenURI returns the URI of the token file with the given extension under
+// base, or "" without a base.
+func tokenURI(base string, tokenID int, ext string) string {
+	if base == "" {
+		return ""
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return fmt.Sprintf("%s%d%s", base, tokenID, ext)
+}
+
+// TokenMetadata builds the metadata JSON of a token. Empty trait types are
+// left out of the attributes. Multi-select trait types get one attribute per
+// value and a count attribute.
+func (g *Generator) TokenMetadata(m *Metadata) *TokenMetadata {
+	tm := &TokenMetadata{
+		Name:       fmt.Sprintf("%s #%d", g.Config.Name, m.TokenID),
+		Image:      tokenURI(g.Config.ImageURI, m.TokenID, ".png"),
+		Attributes: []Attribute{},
+	}
+	if g.Config.Cutout != nil {
+		tm.CutoutImage = tokenURI(g.Config.Cutout.URI, m.TokenID, ".png")
+	}
+	for _, trait := range m.Traits {
+		if trait.TraitKey == NoneKey {
+			continue
+		}
+		tm.Attributes = append(tm.Attributes, Attribute{
+			TraitType: trait.TraitType,
+			Value:     trait.TraitValue,
+		})
+	}
+	for _, traitType := range g.Config.Layers {
+		if g.Config.Traits[traitType].Max == 0 {
+			continue
+		}
+		count := 0
+		for _, trait := range m.Traits {
+			if trait.TraitType == traitType {
+				count++
+			}
+		}
+		tm.Attributes = append(tm.Attributes, Attribute{
+			TraitType: traitType + " Count",
+			Value:     count,
+		})
+	}
+	if m.Mutation != "" {
+		tm.Attributes = append(tm.Attributes, Attribute{
+			TraitType: "Mutation",
+			Value:     g.mutation(m.Mutation).Name,
+		})
+	}
+	return tm
+}
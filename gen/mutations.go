@@ -0,0 +1,199 @@
+package abbc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+
+	"github.com/mroth/weightedrand"
+)
+
+// Mutation is a rare effect applied to the whole composited token. Chance
+// is out of 1000 like trait chances.
+type Mutation struct {
+	Key    string `yaml:"key"`
+	Name   string `yaml:"name"`
+	Effect string `yaml:"effect"`
+	Chance int    `yaml:"chance"`
+}
+
+// mutationEffects are the filters a mutation can use. They only use integer
+// math on the pixels, so a token renders the same on every machine.
+var mutationEffects = map[string]func(img *image.RGBA, m *Metadata, background color.RGBA){
+	"grayscale": grayscale,
+	"invert":    invert,
+	"scanlines": scanlines,
+	"pixelate":  pixelate,
+	"duotone":   duotone,
+	"gold-tint": goldTint,
+}
+
+func newMutationChooser(mutations []Mutation) (*weightedrand.Chooser, error) {
+	if len(mutations) == 0 {
+		return nil, nil
+	}
+
+	total := 0
+	choices := []weightedrand.Choice{}
+	for _, mutation := range mutations {
+		if _, ok := mutationEffects[mutation.Effect]; !ok {
+			return nil, fmt.Errorf("mutation %s has unknown effect %q", mutation.Key, mutation.Effect)
+		}
+		total += mutation.Chance
+		choices = append(choices, weightedrand.Choice{
+			Item:   mutation.Key,
+			Weight: uint(mutation.Chance),
+		})
+	}
+	if total > 1000 {
+		return nil, fmt.Errorf("mutation chances add up to %d, more than 1000", total)
+	}
+	choices = append(choices, weightedrand.Choice{
+		Item:   "",
+		Weight: uint(1000 - total),
+	})
+	return weightedrand.NewChooser(choices...)
+}
+
+func (g *Generator) GetRandomMutation(rs *rand.Rand) string {
+	if g.MutationChooser == nil {
+		return ""
+	}
+	return g.MutationChooser.PickSource(rs).(string)
+}
+
+func (g *Generator) mutation(key string) Mutation {
+	for _, mutation := range g.Config.Mutations {
+		if mutation.Key == key {
+			return mutation
+		}
+	}
+	return Mutation{}
+}
+
+// applyMutation runs the effect of the token's mutation on img. The
+// background colour is taken from the top left pixel of the Background
+// trait.
+func (g *Generator) applyMutation(img *image.RGBA, m *Metadata) {
+	background := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA)
+	for _, trait := range m.Traits {
+		if trait.TraitType != "Background" || trait.TraitKey == NoneKey {
+			continue
+		}
+		if traitImage := g.TraitMaps[trait.TraitType][trait.TraitKey].TraitImage; traitImage != nil {
+			bounds := traitImage.Bounds()
+			background = color.RGBAModel.Convert(traitImage.At(bounds.Min.X, bounds.Min.Y)).(color.RGBA)
+		}
+	}
+
+	effect := mutationEffects[g.mutation(m.Mutation).Effect]
+	effect(img, m, background)
+}
+
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b)) / 1000)
+}
+
+func grayscale(img *image.RGBA, m *Metadata, background color.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		y := luma(img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = y, y, y
+	}
+}
+
+func invert(img *image.RGBA, m *Metadata, background color.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := img.Pix[i+3]
+		img.Pix[i] = a - img.Pix[i]
+		img.Pix[i+1] = a - img.Pix[i+1]
+		img.Pix[i+2] = a - img.Pix[i+2]
+	}
+}
+
+// scanlines darkens every fourth row and shifts a few horizontal bands
+// sideways. The bands come from a random source seeded with the token ID.
+func scanlines(img *image.RGBA, m *Metadata, background color.RGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 4 {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = row[i] / 2
+			row[i+1] = row[i+1] / 2
+			row[i+2] = row[i+2] / 2
+		}
+	}
+
+	rs := rand.New(rand.NewSource(int64(m.TokenID)))
+	width := bounds.Dx()
+	for band := 0; band < 8; band++ {
+		top := bounds.Min.Y + rs.Intn(bounds.Dy())
+		height := 4 + rs.Intn(40)
+		shift := rs.Intn(width/8) - width/16
+		for y := top; y < top+height && y < bounds.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+			shifted := make([]uint8, len(row))
+			for x := 0; x < width; x++ {
+				from := ((x-shift)%width + width) % width
+				copy(shifted[x*4:x*4+4], row[from*4:from*4+4])
+			}
+			copy(row, shifted)
+		}
+	}
+}
+
+func pixelate(img *image.RGBA, m *Metadata, background color.RGBA) {
+	const size = 24
+	bounds := img.Bounds()
+	for top := bounds.Min.Y; top < bounds.Max.Y; top += size {
+		for left := bounds.Min.X; left < bounds.Max.X; left += size {
+			block := image.Rect(left, top, left+size, top+size).Intersect(bounds)
+			var sum [4]int
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					i := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(img.Pix[i+c])
+					}
+				}
+			}
+			n := block.Dx() * block.Dy()
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					i := img.PixOffset(x, y)
+					for c := 0; c < 4; c++ {
+						img.Pix[i+c] = uint8(sum[c] / n)
+					}
+				}
+			}
+		}
+	}
+}
+
+// gradient maps each pixel's brightness onto the line from dark to light.
+// The pixels are alpha-premultiplied, so brightness is measured against
+// alpha and the result is scaled back down by it.
+func gradient(img *image.RGBA, dark, light color.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := int(img.Pix[i+3])
+		if a == 0 {
+			continue
+		}
+		y := int(luma(img.Pix[i], img.Pix[i+1], img.Pix[i+2])) * 255 / a
+		mix := func(from, to uint8) uint8 {
+			return uint8((int(from)*(255-y) + int(to)*y) / 255 * a / 255)
+		}
+		img.Pix[i] = mix(dark.R, light.R)
+		img.Pix[i+1] = mix(dark.G, light.G)
+		img.Pix[i+2] = mix(dark.B, light.B)
+	}
+}
+
+func duotone(img *image.RGBA, m *Metadata, background color.RGBA) {
+	dark := color.RGBA{background.R / 5, background.G / 5, background.B / 5, 255}
+	gradient(img, dark, background)
+}
+
+func goldTint(img *image.RGBA, m *Metadata, background color.RGBA) {
+	gradient(img, color.RGBA{0x3b, 0x24, 0x06, 0xff}, color.RGBA{0xff, 0xe0, 0x7a, 0xff})
+}
@@ -0,0 +1,161 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// mutationPack returns a generator for the default pack with a mutation
+// named after effect.
+func mutationPack(t *testing.T, effect string) *Generator {
+	return testPack(t, func(c *Config) {
+		c.Mutations = []Mutation{{Key: effect, Name: effect, Effect: effect}}
+	})
+}
+
+// renderMutation renders token 3 with the mutation of mutationPack, and
+// also without a mutation to compare against.
+func renderMutation(t *testing.T, g *Generator, effect string) (plain, mutated *image.RGBA) {
+	t.Helper()
+	m, err := g.GenerateMetadata(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Mutation = ""
+	img, err := g.Render(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain = img.(*image.RGBA)
+	m.Mutation = effect
+	img, err = g.Render(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain, img.(*image.RGBA)
+}
+
+// gradientPixel is the colour a pixel of brightness y out of 1 gets on the
+// line from dark to light, premultiplied by alpha a.
+func gradientPixel(dark, light color.RGBA, y float64, a uint8) color.RGBA {
+	mix := func(from, to uint8) uint8 {
+		return uint8((float64(from)*(1-y) + float64(to)*y) * float64(a) / 255)
+	}
+	return color.RGBA{mix(dark.R, light.R), mix(dark.G, light.G), mix(dark.B, light.B), a}
+}
+
+func brightness(c color.RGBA) float64 {
+	if c.A == 0 {
+		return 0
+	}
+	return (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / float64(c.A)
+}
+
+func TestMutationPixels(t *testing.T) {
+	gold := func(c, background color.RGBA) color.RGBA {
+		if c.A == 0 {
+			return c
+		}
+		return gradientPixel(color.RGBA{0x3b, 0x24, 0x06, 0xff}, color.RGBA{0xff, 0xe0, 0x7a, 0xff}, brightness(c), c.A)
+	}
+	tests := []struct {
+		effect string
+		// tolerance is how far a channel may be off from want, for the
+		// effects that round along the way.
+		tolerance int
+		want      func(c, background color.RGBA) color.RGBA
+	}{
+		{"grayscale", 0, func(c, background color.RGBA) color.RGBA {
+			y := uint8((299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000)
+			return color.RGBA{y, y, y, c.A}
+		}},
+		{"invert", 0, func(c, background color.RGBA) color.RGBA {
+			return color.RGBA{c.A - c.R, c.A - c.G, c.A - c.B, c.A}
+		}},
+		{"duotone", 3, func(c, background color.RGBA) color.RGBA {
+			if c.A == 0 {
+				return c
+			}
+			dark := color.RGBA{background.R / 5, background.G / 5, background.B / 5, 255}
+			return gradientPixel(dark, background, brightness(c), c.A)
+		}},
+		{"gold-tint", 3, gold},
+	}
+	for _, tc := range tests {
+		t.Run(tc.effect, func(t *testing.T) {
+			plain, mutated := renderMutation(t, mutationPack(t, tc.effect), tc.effect)
+			// Backgrounds fill the pack squares, so the corner is the
+			// background colour.
+			background := plain.RGBAAt(0, 0)
+			bad := 0
+			for y := plain.Rect.Min.Y; y < plain.Rect.Max.Y; y++ {
+				for x := plain.Rect.Min.X; x < plain.Rect.Max.X; x++ {
+					got, want := mutated.RGBAAt(x, y), tc.want(plain.RGBAAt(x, y), background)
+					if !near(got, want, tc.tolerance) {
+						if bad < 5 {
+							t.Errorf("(%d, %d): %v becomes %v, want %v", x, y, plain.RGBAAt(x, y), got, want)
+						}
+						bad++
+					}
+				}
+			}
+			if bad > 0 {
+				t.Errorf("%d pixels differ", bad)
+			}
+		})
+	}
+}
+
+func near(a, b color.RGBA, tolerance int) bool {
+	diff := func(x, y uint8) bool {
+		d := int(x) - int(y)
+		return d > tolerance || -d > tolerance
+	}
+	return !diff(a.R, b.R) && !diff(a.G, b.G) && !diff(a.B, b.B) && a.A == b.A
+}
+
+func TestMutationPixelate(t *testing.T) {
+	plain, mutated := renderMutation(t, mutationPack(t, "pixelate"), "pixelate")
+
+	const size = 24
+	r := plain.Rect
+	for top := r.Min.Y; top < r.Max.Y; top += size {
+		for left := r.Min.X; left < r.Max.X; left += size {
+			block := image.Rect(left, top, left+size, top+size).Intersect(r)
+			var sum [4]int
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					c := plain.RGBAAt(x, y)
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+int(c.R), sum[1]+int(c.G), sum[2]+int(c.B), sum[3]+int(c.A)
+				}
+			}
+			n := block.Dx() * block.Dy()
+			want := color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), uint8(sum[3] / n)}
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					if got := mutated.RGBAAt(x, y); got != want {
+						t.Fatalf("(%d, %d) = %v, want the average %v of its block %v", x, y, got, want, block)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMutationScanlines(t *testing.T) {
+	// Pack colours depend on the directory it is written to, so both runs
+	// use the same pack.
+	g := mutationPack(t, "scanlines")
+	plain, first := renderMutation(t, g, "scanlines")
+	_, second := renderMutation(t, g, "scanlines")
+	if !bytes.Equal(first.Pix, second.Pix) {
+		t.Error("scanlines differ between two renders of the same token")
+	}
+	if bytes.Equal(first.Pix, plain.Pix) {
+		t.Error("scanlines left the token unchanged")
+	}
+}
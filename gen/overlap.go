@@ -0,0 +1,138 @@
+package abbc
+
+import (
+	"context"
+	"image"
+	"math/bits"
+	"sort"
+)
+
+// An Overlap is how many opaque pixels of a trait the trait of a later
+// layer covers when both are drawn as they are.
+type Overlap struct {
+	Lower, Upper MetadataTrait
+
+	// Covered is the number of opaque pixels of Lower under opaque pixels
+	// of Upper, out of the Opaque pixels of Lower.
+	Covered int
+	Opaque  int
+}
+
+// Percent returns the share of Lower that Upper covers.
+func (o Overlap) Percent() float64 {
+	if o.Opaque == 0 {
+		return 0
+	}
+	return 100 * float64(o.Covered) / float64(o.Opaque)
+}
+
+// Overlaps measures every pair of trait values of different types, leaving
+// out the types in skip, and returns the pairs that overlap at all, worst
+// first.
+func (g *Generator) Overlaps(skip map[string]bool) []Overlap {
+	bounds := image.Rectangle{}
+	for _, traitType := range g.Config.Layers {
+		for _, trait := range g.TraitMaps[traitType] {
+			if trait.TraitImage != nil {
+				bounds = bounds.Union(trait.TraitImage.Bounds())
+			}
+		}
+	}
+
+	type layerTrait struct {
+		trait MetadataTrait
+		mask  opaqueMask
+	}
+	layers := [][]layerTrait{}
+	for _, traitType := range g.Config.Layers {
+		if skip[traitType] {
+			continue
+		}
+		traits := []layerTrait{}
+		for key, trait := range g.TraitMaps[traitType] {
+			if key == NoneKey || trait.TraitImage == nil {
+				continue
+			}
+			traits = append(traits, layerTrait{
+				trait: MetadataTrait{TraitType: traitType, TraitKey: key, TraitValue: trait.TraitValue},
+				mask:  newOpaqueMask(trait.TraitImage, bounds),
+			})
+		}
+		layers = append(layers, traits)
+	}
+
+	overlaps := []Overlap{}
+	for i, lowers := range layers {
+		for _, uppers := range layers[i+1:] {
+			for _, lower := range lowers {
+				opaque := lower.mask.count(nil)
+				for _, upper := range uppers {
+					covered := lower.mask.count(upper.mask)
+					if covered == 0 {
+						continue
+					}
+					overlaps = append(overlaps, Overlap{
+						Lower:   lower.trait,
+						Upper:   upper.trait,
+						Covered: covered,
+						Opaque:  opaque,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(overlaps, func(i, j int) bool {
+		a, b := overlaps[i], overlaps[j]
+		if a.Covered != b.Covered {
+			return a.Covered > b.Covered
+		}
+		if a.Lower.TraitKey != b.Lower.TraitKey {
+			return a.Lower.TraitKey < b.Lower.TraitKey
+		}
+		return a.Upper.TraitKey < b.Upper.TraitKey
+	})
+	return overlaps
+}
+
+// PairRules renders the two traits with every other layer empty and returns
+// the rules that applied, including disabled ones.
+func (g *Generator) PairRules(ctx context.Context, lower, upper MetadataTrait) ([]string, error) {
+	_, trace, err := g.RenderTrace(ctx, g.layerMetadata([]MetadataTrait{lower, upper}))
+	if err != nil {
+		return nil, err
+	}
+	return trace.Rules, nil
+}
+
+// An opaqueMask has a bit set for every pixel of an image with at least half
+// opacity, over a rectangle shared by all masks compared with it.
+type opaqueMask []uint64
+
+func newOpaqueMask(img image.Image, bounds image.Rectangle) opaqueMask {
+	mask := make(opaqueMask, (bounds.Dx()*bounds.Dy()+63)/64)
+	r := img.Bounds().Intersect(bounds)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !opaque(img, x, y) {
+				continue
+			}
+			i := (y-bounds.Min.Y)*bounds.Dx() + x - bounds.Min.X
+			mask[i/64] |= 1 << (i % 64)
+		}
+	}
+	return mask
+}
+
+// count returns the number of pixels set in m, or with cover only those
+// also set in cover.
+func (m opaqueMask) count(cover opaqueMask) int {
+	n := 0
+	for i, word := range m {
+		if cover != nil {
+			word &= cover[i]
+		}
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package abbc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOverlaps(t *testing.T) {
+	g := &Generator{
+		Config: &Config{Layers: []string{"Background", "Clothes", "Head"}},
+		TraitMaps: map[string]map[string]TraitData{
+			"Background": {
+				"gray": {TraitImage: solidLayer(image.Rect(0, 0, 1262, 1262), color.Gray{128})},
+			},
+			"Clothes": {
+				"hoodie": {TraitImage: solidLayer(image.Rect(0, 800, 1000, 1262), color.Black)},
+			},
+			"Head": {
+				"beanie": {TraitImage: solidLayer(image.Rect(300, 100, 700, 300), color.White)},
+				"hood":   {TraitImage: solidLayer(image.Rect(0, 700, 100, 1262), color.White)},
+				NoneKey:  {},
+			},
+		},
+	}
+
+	overlaps := g.Overlaps(map[string]bool{"Background": true})
+	if len(overlaps) != 1 {
+		t.Fatalf("got %d overlaps, want only hoodie under hood: %v", len(overlaps), overlaps)
+	}
+	o := overlaps[0]
+	if o.Lower.TraitKey != "hoodie" || o.Upper.TraitKey != "hood" {
+		t.Errorf("got %s under %s", o.Lower.TraitKey, o.Upper.TraitKey)
+	}
+	if o.Covered != 100*462 || o.Opaque != 1000*462 {
+		t.Errorf("covered %d of %d pixels, want %d of %d", o.Covered, o.Opaque, 100*462, 1000*462)
+	}
+	if o.Percent() != 10 {
+		t.Errorf("Percent() = %v, want 10", o.Percent())
+	}
+}
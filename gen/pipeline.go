@@ -0,0 +1,155 @@
+package abbc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pipeline generates a range of tokens in four stages connected by bounded
+// channels: picking traits, compositing, encoding and writing to Sink.
+// Traits are picked per token from the generator seed, so the output does
+// not depend on Workers.
+type Pipeline struct {
+	Generator *Generator
+	Sink      Sink
+
+	// Workers is the number of goroutines for each of the compositing,
+	// encoding and writing stages.
+	Workers int
+
+	// KeepGoing keeps the pipeline running after a token fails. Otherwise
+	// the first failure stops it.
+	KeepGoing bool
+
+	// Skip holds token IDs that are already finished, for example by an
+	// interrupted run. They are not generated again.
+	Skip map[int]bool
+
+	// OnToken is called from the pipeline goroutines after each token is
+	// written or has failed.
+	OnToken func(tokenID int, err *TokenError)
+}
+
+// Run generates the tokens with IDs from up to but not including to and
+// returns the failed tokens. Tokens interrupted because the pipeline stopped
+// are not failures; tokens that fail for another reason while it stops are.
+func (p *Pipeline) Run(ctx context.Context, from, to int) []*TokenError {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	mu := &sync.Mutex{}
+	failures := []*TokenError{}
+	done := func(tokenID int, err *TokenError) {
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				// Interrupted by the stop, not a failure itself.
+				return
+			}
+			mu.Lock()
+			failures = append(failures, err)
+			mu.Unlock()
+			if !p.KeepGoing {
+				cancel()
+			}
+		}
+		if p.OnToken != nil {
+			p.OnToken(tokenID, err)
+		}
+	}
+
+	selected := make(chan *Metadata, workers)
+	go func() {
+		defer close(selected)
+		for tokenID := from; tokenID < to; tokenID++ {
+			if p.Skip[tokenID] {
+				continue
+			}
+			m, err := p.Generator.GenerateMetadata(tokenID)
+			if err != nil {
+				done(tokenID, &TokenError{TokenID: tokenID, Err: err})
+				continue
+			}
+			select {
+			case selected <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	rendered := make(chan *Token, workers)
+	stage(workers, func() {
+		for m := range selected {
+			t, err := p.Generator.Token(ctx, m)
+			if err != nil {
+				done(m.TokenID, tokenError(m, err))
+				continue
+			}
+			select {
+			case rendered <- t:
+			case <-ctx.Done():
+			}
+		}
+	}, func() { close(rendered) })
+
+	encoded := make(chan *Token, workers)
+	stage(workers, func() {
+		for t := range rendered {
+			err := t.Encode()
+			if err != nil {
+				done(t.Metadata.TokenID, tokenError(t.Metadata, err))
+				continue
+			}
+			select {
+			case encoded <- t:
+			case <-ctx.Done():
+			}
+		}
+	}, func() { close(encoded) })
+
+	written := make(chan struct{})
+	stage(workers, func() {
+		for t := range encoded {
+			err := p.Sink.Write(t)
+			if err != nil {
+				done(t.Metadata.TokenID, tokenError(t.Metadata, err))
+				continue
+			}
+			done(t.Metadata.TokenID, nil)
+		}
+	}, func() { close(written) })
+
+	<-written
+	return failures
+}
+
+// tokenError returns err as a *TokenError of the token m.
+func tokenError(m *Metadata, err error) *TokenError {
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr
+	}
+	return &TokenError{TokenID: m.TokenID, Traits: m.Traits, Err: err}
+}
+
+// stage runs work on n goroutines and calls closed once all have returned.
+func stage(n int, work func(), closed func()) {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		closed()
+	}()
+}
@@ -0,0 +1,82 @@
+package abbc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"abbc/gen/abbctest"
+)
+
+func TestPipelineWorkers(t *testing.T) {
+	g := testPack(t, nil)
+
+	run := func(workers int) *MemorySink {
+		sink := &MemorySink{}
+		p := &Pipeline{Generator: g, Sink: sink, Workers: workers}
+		if failures := p.Run(context.Background(), 0, 24); len(failures) != 0 {
+			t.Fatal(failures[0])
+		}
+		return sink
+	}
+	one := run(1)
+	four := run(4)
+
+	picked := map[string]bool{}
+	for tokenID := 0; tokenID < 24; tokenID++ {
+		a, b := one.Get(tokenID), four.Get(tokenID)
+		if a == nil || b == nil {
+			t.Fatalf("token %d missing", tokenID)
+		}
+		if !bytes.Equal(a.Encoded, b.Encoded) {
+			t.Errorf("token %d differs between 1 and 4 workers", tokenID)
+		}
+		if got, want := len(a.Metadata.Traits), len(abbctest.Layers); got != want {
+			t.Errorf("token %d has %d traits, want %d", tokenID, got, want)
+		}
+		for _, trait := range a.Metadata.Traits {
+			picked[trait.TraitType+"="+trait.TraitKey] = true
+		}
+	}
+	for _, key := range abbctest.Traits["Background"] {
+		if !picked["Background="+key] {
+			t.Errorf("Background %s never picked in 24 tokens", key)
+		}
+	}
+}
+
+// failSink fails every token after the first few with a plain error.
+type failSink struct {
+	MemorySink
+	written int32
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (s *failSink) Write(t *Token) error {
+	if atomic.AddInt32(&s.written, 1) > 2 {
+		return errDiskFull
+	}
+	return s.MemorySink.Write(t)
+}
+
+func TestPipelineFailures(t *testing.T) {
+	g := testPack(t, nil)
+	for _, keepGoing := range []bool{false, true} {
+		p := &Pipeline{Generator: g, Sink: &failSink{}, Workers: 4, KeepGoing: keepGoing}
+		failures := p.Run(context.Background(), 0, 12)
+		if len(failures) == 0 {
+			t.Fatalf("keep going %v: no failures", keepGoing)
+		}
+		if keepGoing && len(failures) != 10 {
+			t.Errorf("keep going: %d failures, want 10", len(failures))
+		}
+		for _, failure := range failures {
+			if !errors.Is(failure, errDiskFull) || len(failure.Traits) == 0 {
+				t.Errorf("keep going %v: failure %v", keepGoing, failure)
+			}
+		}
+	}
+}
@@ -2,21 +2,93 @@ package abbc
 
 import (
 	"image"
+	"math/rand"
 
 	wr "github.com/mroth/weightedrand"
 )
 
+// NoneKey is the trait key used when a trait type is left empty.
+const NoneKey = "__NONE__"
+
 type Trait struct {
 	TraitType  string
 	TraitValue string
 	Weight     float64
 }
 
+// TraitData is a loaded trait value. TraitKey is the stable identifier used
+// by the compositing rules and TraitValue is the display name shown in the
+// token metadata.
 type TraitData struct {
 	TraitType        string
+	TraitKey         string
 	TraitValue       string
+	Description      string
+	Tags             []string
+	Rarity           string
 	TraitProbability int
 	TraitImage       image.Image
+
+	// TraitFile is the path of TraitImage relative to the config directory.
+	TraitFile string
+
+	// Animation is nil unless the value has frames.
+	Animation *Animation
+}
+
+func (g *Generator) GetRandomTrait(rs *rand.Rand, traitType string) (string, error) {
+	result := g.TraitChoosers[traitType].PickSource(rs).(string)
+	return result, nil
+}
+
+// GetRandomTraits picks the values of a multi-select trait type. Values are
+// drawn by weight without replacement until the empty value is drawn or max
+// values are picked. The result is in config order, which is the order the
+// values are layered in.
+func (g *Generator) GetRandomTraits(rs *rand.Rand, traitType string) ([]string, error) {
+	traitData := g.Config.Traits[traitType]
+	traitMap := g.TraitMaps[traitType]
+
+	picked := make(map[string]bool)
+	for len(picked) < traitData.Max {
+		choices := []wr.Choice{}
+		for _, datum := range traitData.Values {
+			if picked[datum.Key] || traitMap[datum.Key].TraitProbability < 1 {
+				continue
+			}
+			choices = append(choices, wr.Choice{
+				Item:   datum.Key,
+				Weight: uint(traitMap[datum.Key].TraitProbability),
+			})
+		}
+		if len(choices) == 0 {
+			break
+		}
+		if none, ok := traitMap[NoneKey]; ok && len(picked) >= traitData.Min {
+			choices = append(choices, wr.Choice{
+				Item:   NoneKey,
+				Weight: uint(none.TraitProbability),
+			})
+		}
+
+		chooser, err := wr.NewChooser(choices...)
+		if err != nil {
+			return nil, err
+		}
+		traitKey := chooser.PickSource(rs).(string)
+		if traitKey == NoneKey {
+			break
+		}
+		picked[traitKey] = true
+	}
+
+	traitKeys := []string{}
+	for _, datum := range traitData.Values {
+		if picked[datum.Key] {
+			traitKeys = append(traitKeys, datum.Key)
+		}
+	}
+	return traitKeys, nil
 }
 
 func GetRandomTrait(traits map[string]TraitData) (string, error) {
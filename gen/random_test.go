@@ -0,0 +1,57 @@
+package abbc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGetRandomTraits(t *testing.T) {
+	values := []Datum{
+		{Key: "pin"}, {Key: "chain"}, {Key: "ring"}, {Key: "watch"}, {Key: "badge"},
+	}
+	traitMap := map[string]TraitData{}
+	for _, datum := range values {
+		traitMap[datum.Key] = TraitData{TraitKey: datum.Key, TraitProbability: 100}
+	}
+	g := &Generator{
+		Config: &Config{
+			Traits: map[string]YamlTraitData{
+				"Accessories": {Min: 1, Max: 3, Values: values},
+			},
+		},
+		TraitMaps: map[string]map[string]TraitData{"Accessories": traitMap},
+	}
+
+	rs := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		traitKeys, err := g.GetRandomTraits(rs, "Accessories")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(traitKeys) != 3 {
+			t.Fatalf("got %v, want 3 values", traitKeys)
+		}
+		last := -1
+		for _, traitKey := range traitKeys {
+			i := 0
+			for values[i].Key != traitKey {
+				i++
+			}
+			if i <= last {
+				t.Fatalf("got %v, want distinct values in config order", traitKeys)
+			}
+			last = i
+		}
+	}
+
+	traitMap[NoneKey] = TraitData{TraitKey: NoneKey, TraitProbability: 1 << 40}
+	for n := 0; n < 100; n++ {
+		traitKeys, err := g.GetRandomTraits(rs, "Accessories")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(traitKeys) != 1 {
+			t.Fatalf("got %v, want only the minimum of 1 value", traitKeys)
+		}
+	}
+}
@@ -0,0 +1,739 @@
+package abbc
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// TokenError is an error generating a single token. Traits is empty when
+// the error happened while picking them.
+type TokenError struct {
+	TokenID int
+	Traits  []MetadataTrait
+	Err     error
+}
+
+func (e *TokenError) Error() string {
+	traits := []string{}
+	for _, trait := range e.Traits {
+		traits = append(traits, trait.TraitType+"="+trait.TraitKey)
+	}
+	if len(traits) == 0 {
+		return fmt.Sprintf("token %d: %v", e.TokenID, e.Err)
+	}
+	return fmt.Sprintf("token %d (%s): %v", e.TokenID, strings.Join(traits, ", "), e.Err)
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// A Trace records the inputs of a rendered token: the image files drawn or
+// consulted, and the rules whose conditions held, including disabled ones.
+type Trace struct {
+	Files []string `json:"files"`
+	Rules []string `json:"rules,omitempty"`
+
+	// Visible is the share in percent of each trait's pixels that shows in
+	// the token, and Hidden the traits below the visibility threshold. Both
+	// are only filled in when the config sets one.
+	Visible map[string]float64 `json:"visible,omitempty"`
+	Hidden  []string           `json:"hidden,omitempty"`
+
+	// Steps lists what was done to the canvas, in order.
+	Steps []Step `json:"steps,omitempty"`
+}
+
+// A Step is one image drawn onto a token, or one mask or mutation applied
+// to it, while the trait of type Layer was being drawn.
+type Step struct {
+	Layer string `json:"layer,omitempty"`
+	Op    string `json:"op"`
+
+	// Image is "Type=key" for trait images, "special:name" for special
+	// images and the mutation name for mutations.
+	Image string `json:"image,omitempty"`
+
+	// Crop is the canvas rectangle the image was cut to or the mask
+	// covered, as x0, y0, x1, y1.
+	Crop []int `json:"crop,omitempty"`
+
+	// Rule is the rule the step was taken for, empty for the trait itself.
+	Rule string `json:"rule,omitempty"`
+}
+
+// Step operations.
+const (
+	StepDraw     = "draw"
+	StepMask     = "mask"
+	StepMutation = "mutation"
+)
+
+func rectList(r image.Rectangle) []int {
+	return []int{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y}
+}
+
+func (t *Trace) addFile(file string) {
+	if file != "" && !contains(t.Files, file) {
+		t.Files = append(t.Files, file)
+	}
+}
+
+func (t *Trace) addRule(name string) {
+	if !contains(t.Rules, name) {
+		t.Rules = append(t.Rules, name)
+	}
+}
+
+func (t *Trace) addAnimation(a *Animation) {
+	for _, file := range a.Files {
+		t.addFile(file)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Render composites the token described by m and returns the image. It does
+// not write anything; hand the result to a Sink for that.
+func (g *Generator) Render(ctx context.Context, m *Metadata) (image.Image, error) {
+	img, _, err := g.RenderTrace(ctx, m)
+	return img, err
+}
+
+// RenderTrace is Render that also returns the inputs of the token.
+func (g *Generator) RenderTrace(ctx context.Context, m *Metadata) (image.Image, *Trace, error) {
+	return g.render(ctx, m, renderOptions{})
+}
+
+// RenderCutout renders the token without its Background, leaving everything
+// behind the character transparent.
+func (g *Generator) RenderCutout(ctx context.Context, m *Metadata) (image.Image, error) {
+	img, _, err := g.render(ctx, m, renderOptions{cutout: true})
+	return img, err
+}
+
+// renderOptions select a variant of a token. With animated set, animated
+// images are drawn with their frame at index frame instead.
+type renderOptions struct {
+	cutout   bool
+	animated bool
+	frame    int
+}
+
+// turns returns traits with an empty value for every rule trait type that
+// has none, so that the rules drawn on its turn still run when a
+// multi-select type picked no values.
+func (g *Generator) turns(traits []MetadataTrait) []MetadataTrait {
+	present := make(map[string]bool)
+	for _, trait := range traits {
+		present[trait.TraitType] = true
+	}
+	missing := false
+	for _, traitType := range g.Config.Layers {
+		if ruleTraitTypes[traitType] && !present[traitType] {
+			missing = true
+		}
+	}
+	if !missing {
+		return traits
+	}
+
+	turns := []MetadataTrait{}
+	for _, traitType := range g.Config.Layers {
+		if ruleTraitTypes[traitType] && !present[traitType] {
+			turns = append(turns, MetadataTrait{TraitType: traitType, TraitKey: NoneKey})
+			continue
+		}
+		for _, trait := range traits {
+			if trait.TraitType == traitType {
+				turns = append(turns, trait)
+			}
+		}
+	}
+	return turns
+}
+
+func (g *Generator) render(ctx context.Context, m *Metadata, opts renderOptions) (image.Image, *Trace, error) {
+	r := image.Rectangle{image.Point{0, 0}, image.Point{1262, 1262}}
+	newImage := image.NewRGBA(r)
+
+	traits := g.turns(m.Traits)
+	start := 0
+	if g.Prefixes != nil && !opts.cutout && !opts.animated {
+		start = g.drawPrefix(newImage, traits)
+	}
+
+	isTrooper := false
+	isGrin := false
+	isSmallGrin := false
+	isDiscomfort := false
+	isBored := false
+	isBoredUnshaven := false
+	isPhenome := false
+	isHelmet := false
+	isJoint := false
+	isBackwardHat := false
+	isPlasmaVision := false
+	isSportShades := false
+
+	isLasers := false
+
+	isBandanaMouth := false
+	isDumbfounded := false
+	isRose := false
+	isTongue := false
+
+	isSakura := false
+	isFlameShades := false
+
+	isBeanie := false
+	isSweatband := false
+	isBTCBallers := false
+	isBackwardBandana := false
+	isBandanaHead := false
+	isPanelHat := false
+	isBlondeBraids := false
+
+	isGeometricShades := false
+	isThickFrameShades := false
+	isOversized := false
+	isGlasses := false
+	isBigGlasses := false
+	isRobot := false
+
+	isDreadlocks := false
+	isMessyHair := false
+	isTwoToneBraids := false
+
+	isZippedPuffer := false
+
+	isGoggles := false
+	// hasTag reports whether the trait is tagged in the config, for rules
+	// that apply to a family of values rather than one.
+	hasTag := func(trait MetadataTrait, tag string) bool {
+		return contains(g.TraitMaps[trait.TraitType][trait.TraitKey].Tags, tag)
+	}
+	for _, trait := range traits {
+
+		if trait.TraitKey == "eth-lasers" {
+			isLasers = true
+		}
+
+		if trait.TraitKey == "robot" {
+			isRobot = true
+		}
+
+		if hasTag(trait, "goggles") {
+			isGoggles = true
+		}
+
+		if trait.TraitKey == "two-tone-braids" {
+			isTwoToneBraids = true
+		}
+		if trait.TraitKey == "dreadlocks" {
+			isDreadlocks = true
+		}
+		if trait.TraitKey == "messy-hair" {
+			isMessyHair = true
+		}
+		if trait.TraitKey == "blonde-braids" {
+			isBlondeBraids = true
+		}
+
+		if trait.TraitKey == "trooper-hat" {
+			isTrooper = true
+		}
+		if hasTag(trait, "grin") {
+			isGrin = true
+		} else if trait.TraitKey == "small-grin" {
+			isSmallGrin = true
+		}
+
+		if (trait.TraitKey == "bored" || trait.TraitKey == "bored-joint") && trait.TraitType == "Mouth" {
+			isBored = true
+		} else if trait.TraitKey == "bored-unshaven" && trait.TraitType == "Mouth" {
+			isBoredUnshaven = true
+		}
+
+		if trait.TraitKey == "phoneme-vuh" {
+			isPhenome = true
+		}
+
+		if trait.TraitKey == "discomfort" {
+			isDiscomfort = true
+		}
+
+		if trait.TraitKey == "army-helmet" {
+			isHelmet = true
+		}
+		if trait.TraitKey == "bored-joint" {
+			isJoint = true
+		}
+		if trait.TraitKey == "backwards-hat" {
+			isBackwardHat = true
+		}
+		if trait.TraitKey == "plasma-vision" {
+			isPlasmaVision = true
+		}
+		if trait.TraitKey == "flame-shades" {
+			isFlameShades = true
+		}
+		if trait.TraitKey == "sport-shades" {
+			isSportShades = true
+		}
+		if trait.TraitKey == "thick-frames" {
+			isThickFrameShades = true
+		}
+		if trait.TraitKey == "oversized" {
+			isOversized = true
+		}
+		if trait.TraitKey == "geometric-shades" {
+			isGeometricShades = true
+		}
+		if hasTag(trait, "glasses") {
+			isGlasses = true
+		}
+
+		if trait.TraitKey == "bitcoin-ballers" {
+			isBTCBallers = true
+		}
+
+		if trait.TraitKey == "backwards-bandana" {
+			isBackwardBandana = true
+		}
+
+		if trait.TraitKey == "beanie" {
+			isBeanie = true
+		}
+
+		if trait.TraitKey == "sweatband" {
+			isSweatband = true
+		}
+
+		if trait.TraitKey == "zipped-puffer" {
+			isZippedPuffer = true
+		}
+
+		if trait.TraitKey == "bandana" && trait.TraitType == "Head" {
+			isBandanaHead = true
+		}
+
+		if trait.TraitKey == "bandana" && trait.TraitType == "Mouth" {
+			isBandanaMouth = true
+		}
+		if trait.TraitKey == "dumbfounded" && trait.TraitType == "Mouth" {
+			isDumbfounded = true
+		}
+		if trait.TraitKey == "rose" && trait.TraitType == "Mouth" {
+			isRose = true
+		}
+		if trait.TraitKey == "tongue" && trait.TraitType == "Mouth" {
+			isTongue = true
+		}
+		if trait.TraitKey == "sakura" && trait.TraitType == "Head" {
+			isSakura = true
+		}
+		if trait.TraitKey == "panel-hat" && trait.TraitType == "Head" {
+			isPanelHat = true
+		}
+	}
+
+	if isFlameShades || isOversized || isPlasmaVision || isBTCBallers {
+		isBigGlasses = true
+	}
+
+	var mouthImage image.Image
+	var headImage image.Image
+	var glassesImage image.Image
+
+	trace := &Trace{}
+	for _, trait := range traits {
+		trace.addFile(g.TraitMaps[trait.TraitType][trait.TraitKey].TraitFile)
+		if a := g.TraitMaps[trait.TraitType][trait.TraitKey].Animation; a != nil {
+			trace.addAnimation(a)
+		}
+	}
+	// step is the rule that fired last for the trait being drawn, and
+	// drawn names the images that can be drawn and where they were cut.
+	var layer, step string
+	type drawnImage struct {
+		name string
+		crop []int
+	}
+	drawn := make(map[image.Image]drawnImage)
+	rule := func(name string) bool {
+		trace.addRule(name)
+		if g.DisabledRules[name] {
+			return false
+		}
+		step = name
+		return true
+	}
+	for _, trait := range traits[:start] {
+		if trait.TraitKey != NoneKey {
+			trace.Steps = append(trace.Steps, Step{Layer: trait.TraitType, Op: StepDraw, Image: traitName(trait)})
+		}
+	}
+
+	var o *owners
+	if g.Config.Visibility.MinPercent > 0 && !opts.animated {
+		o = newOwners(r)
+		for _, trait := range traits[:start] {
+			img := g.TraitMaps[trait.TraitType][trait.TraitKey].TraitImage
+			o.name(img, traitName(trait))
+			o.mark(img)
+		}
+	}
+	// The images rules redraw are nil when their trait type is empty or
+	// not a layer, and are then skipped.
+	drawImage := func(img image.Image) {
+		if img == nil {
+			return
+		}
+		trace.Steps = append(trace.Steps, Step{
+			Layer: layer,
+			Op:    StepDraw,
+			Image: drawn[img].name,
+			Crop:  drawn[img].crop,
+			Rule:  step,
+		})
+		drawLayer(newImage, img)
+		if o != nil {
+			o.mark(img)
+		}
+	}
+	crop := func(img image.Image, r image.Rectangle) image.Image {
+		if img == nil {
+			return nil
+		}
+		cropped := cropLayer(img, r)
+		drawn[cropped] = drawnImage{name: drawn[img].name, crop: rectList(cropped.Bounds())}
+		if o != nil {
+			o.of[cropped] = o.of[img]
+		}
+		return cropped
+	}
+	special := func(name string) image.Image {
+		trace.addFile(g.SpecialFiles[name])
+		img := g.SpecialImages[name]
+		if a := g.SpecialAnimations[name]; a != nil {
+			trace.addAnimation(a)
+			if opts.animated {
+				img = a.Frames[opts.frame%len(a.Frames)]
+			}
+		}
+		drawn[img] = drawnImage{name: "special:" + name}
+		if o != nil {
+			for _, trait := range traits {
+				if trait.TraitType == specialTraitType(name) {
+					o.name(img, traitName(trait))
+					break
+				}
+			}
+		}
+		return img
+	}
+	traitImage := func(traitType, traitKey string) image.Image {
+		trait := g.TraitMaps[traitType][traitKey]
+		trace.addFile(trait.TraitFile)
+		img := trait.TraitImage
+		if a := trait.Animation; a != nil {
+			trace.addAnimation(a)
+			if opts.animated {
+				img = a.Frames[opts.frame%len(a.Frames)]
+			}
+		}
+		drawn[img] = drawnImage{name: traitType + "=" + traitKey}
+		if o != nil {
+			o.name(img, traitType+"="+traitKey)
+		}
+		return img
+	}
+
+	isBigHead := false
+	if isSakura || isMessyHair || isTwoToneBraids || isDreadlocks || isTrooper {
+		isBigHead = true
+	}
+
+	// The values of a multi-select type share one turn: the rules run on
+	// the first, and the others are drawn after it unless a rule replaced
+	// the trait.
+	replaced := false
+	for i, trait := range traits[start:] {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		layer, step = trait.TraitType, ""
+		if i > 0 && traits[start+i-1].TraitType == trait.TraitType {
+			if !replaced {
+				drawImage(traitImage(trait.TraitType, trait.TraitKey))
+			}
+			continue
+		}
+		replaced = true
+		if opts.cutout && trait.TraitType == "Background" {
+			continue
+		}
+
+		if isTrooper && trait.TraitType == "Eyes" && rule("trooper-hat-right") {
+			drawImage(special("Trooper Hat Right"))
+		}
+
+		if trait.TraitType == "Eyes" && isGlasses && rule("glasses-over-head") {
+			glassesImage = traitImage(trait.TraitType, trait.TraitKey)
+
+			if isOversized && isBeanie && rule("beanie-oversized") {
+				glassesImage = special("beanie-oversized-eyes")
+			} else if isThickFrameShades && isBackwardBandana && rule("backwards-bandana-thick-frames") {
+				glassesImage = special("backwards-bandana-thick-frame-glasses")
+			} else if isOversized && isBlondeBraids && rule("blonde-braids-oversized") {
+				glassesImage = special("blonde-braids-oversized-glasses")
+			}
+
+			drawImage(traitImage("Eyes", "bored"))
+			continue
+		}
+
+		if trait.TraitType == "Head" {
+			headImage = traitImage(trait.TraitType, trait.TraitKey)
+		}
+
+		if isBeanie && isOversized && trait.TraitType == "Head" && rule("beanie-oversized") {
+			headImage = special("beanie-oversized-head")
+			continue
+		}
+
+		if isRobot && isGoggles && trait.TraitType == "Head" && rule("goggles-robot-head") {
+			headImage = special("goggles-robot-head")
+			drawImage(headImage)
+			continue
+		}
+
+		if isBeanie && isOversized && trait.TraitType == "Jewelry" && rule("beanie-oversized") {
+			drawImage(headImage)
+			continue
+		}
+
+		if trait.TraitType == "Mouth" {
+			mouthImage = traitImage(trait.TraitType, trait.TraitKey)
+			if isGlasses && !(isFlameShades && (isTrooper || isHelmet)) && rule("glasses-over-head") {
+				drawImage(glassesImage)
+			}
+			if isBigHead && rule("big-head-over-glasses") {
+				drawImage(headImage)
+			}
+
+			if isGlasses && isHelmet && rule("helmet-over-glasses") {
+				drawImage(crop(headImage, image.Rect(0, 0, r.Max.X, 550)))
+			}
+
+			if isGlasses && isGoggles && !(isPlasmaVision || isFlameShades) && rule("goggles-over-glasses") {
+				drawImage(crop(headImage, image.Rect(0, 0, 535, r.Max.Y)))
+				if isOversized {
+					drawImage(special("Oversized Goggle Line"))
+				}
+			}
+
+			if isTrooper && isBandanaMouth && rule("trooper-hat-bandana") {
+				drawImage(special("Trooper Hat Bandana"))
+				continue
+			}
+		}
+
+		if isSakura && trait.TraitType == "Jewelry" && rule("sakura-mouth") {
+			drawImage(mouthImage)
+		}
+
+		if (isTwoToneBraids || isDreadlocks) && trait.TraitType == "Jewelry" && rule("braids-over-jewelry") {
+			drawImage(headImage)
+		}
+
+		if (isTrooper || isBackwardHat) && isGrin && trait.TraitType == "Jewelry" && rule("grin-left") {
+			drawImage(special("Grin Left"))
+		}
+
+		if (isTrooper || isBackwardHat) && isRose && trait.TraitType == "Jewelry" && rule("hat-rose") {
+			drawImage(mouthImage)
+		}
+
+		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isBTCBallers && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.SpecialImages["BTC Ballers Top"])
+		// }
+
+		if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isPlasmaVision && trait.TraitType == "Jewelry" && rule("plasma-vision-over-hat") {
+			if isBandanaMouth {
+				drawImage(special("Plasma vision cut bottom"))
+			} else {
+				drawImage(special("Plasma vision"))
+				if isDumbfounded {
+					drawImage(special("Nostril"))
+				}
+			}
+		}
+
+		// if (isHelmet) && isFlameShades && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.TraitMaps["Eyes"]["flame-shades"].TraitImage)
+		// }
+
+		// if (isTrooper) && isFlameShades && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.TraitMaps["Eyes"]["flame-shades"].TraitImage)
+		// }
+
+		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isSportShades && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.SpecialImages["Sport shades"])
+		// }
+
+		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isFlameShades && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.SpecialImages["Flame shades"])
+		// }
+
+		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isOversized && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.TraitMaps["Eyes"]["oversized"].TraitImage)
+		// }
+
+		// if (isTrooper || isBackwardHat || isBackwardBandana || isBandanaHead || isBeanie || isSweatband) && isGeometricShades && trait.TraitType == "Jewelry" {
+		// 	drawImage(g.TraitMaps["Eyes"]["geometric-shades"].TraitImage)
+		// }
+
+		if isHelmet && trait.TraitType == "Clothes" && rule("helmet-mask") {
+			var background image.Image = &image.Uniform{newImage.At(500, 0)}
+			if opts.cutout {
+				background = image.Transparent
+			}
+			maskImage := image.NewRGBA(image.Rect(280, 400, 350, 530))
+			draw.Draw(newImage, maskImage.Bounds(), background, image.ZP, draw.Src)
+			if o != nil {
+				o.clear(maskImage.Bounds())
+			}
+			trace.Steps = append(trace.Steps, Step{Layer: layer, Op: StepMask, Crop: rectList(maskImage.Bounds()), Rule: step})
+		}
+
+		if isBackwardHat && isBandanaMouth && trait.TraitType == "Jewelry" && rule("bandana-left") {
+			drawImage(special("Bandana Left"))
+		}
+
+		if isPlasmaVision && isBandanaMouth && trait.TraitType == "Head" && rule("plasma-vision-head") {
+			drawImage(special("Plasma vision"))
+		} else if isPlasmaVision && trait.TraitType == "Head" && rule("plasma-vision-head") {
+			drawImage(special("Plasma vision bottom"))
+			if isDumbfounded && trait.TraitType == "Head" {
+				drawImage(special("Nostril"))
+			}
+		}
+
+		if isTrooper && isRose && trait.TraitType == "Jewelry" && rule("trooper-rose") {
+			drawImage(mouthImage)
+		}
+
+		if isFlameShades && (isTrooper || isHelmet) && trait.TraitType == "Jewelry" && rule("flame-shades-over-hat") {
+			drawImage(traitImage("Eyes", "flame-shades"))
+		}
+
+		if isPanelHat && isSportShades && trait.TraitType == "Jewelry" && rule("panel-hat-sport-shades") {
+			drawImage(traitImage("Head", "panel-hat"))
+		}
+
+		if isZippedPuffer && isGrin && trait.TraitType == "Mouth" && rule("puffer-grin") {
+			mouthImage = special("grin-puffer-mouth")
+			drawImage(special("grin-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isSmallGrin && trait.TraitType == "Mouth" && rule("puffer-small-grin") {
+			mouthImage = special("small-grin-puffer-mouth")
+			drawImage(special("small-grin-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isRose && trait.TraitType == "Mouth" && rule("puffer-rose") {
+			mouthImage = special("rose-puffer-mouth")
+			drawImage(special("rose-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isDiscomfort && trait.TraitType == "Mouth" && rule("puffer-discomfort") {
+			mouthImage = special("discomfort-puffer-mouth")
+			drawImage(special("discomfort-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isBored && trait.TraitType == "Mouth" && rule("puffer-bored") {
+			mouthImage = special("bored-puffer-mouth")
+			drawImage(special("bored-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isBoredUnshaven && trait.TraitType == "Mouth" && rule("puffer-bored-unshaven") {
+			mouthImage = special("bored-unshaven-puffer-mouth")
+			drawImage(special("bored-unshaven-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isPhenome && trait.TraitType == "Mouth" && rule("puffer-phoneme-vuh") {
+			mouthImage = special("phenome-puffer-mouth")
+			drawImage(special("phenome-puffer-mouth"))
+			continue
+		}
+
+		if isZippedPuffer && isTongue && trait.TraitType == "Mouth" && rule("puffer-tongue") {
+			mouthImage = special("tongue-puffer-mouth")
+			drawImage(special("tongue-puffer-mouth"))
+			continue
+		}
+
+		if isBackwardBandana && isGlasses && !isBigGlasses && trait.TraitType == "Jewelry" && rule("backwards-bandana-over-glasses") {
+			if isGeometricShades {
+				drawImage(crop(headImage, image.Rect(0, 0, 535, r.Max.Y)))
+			} else {
+				drawImage(headImage)
+			}
+		}
+
+		if isRobot && isPanelHat && trait.TraitType == "Jewelry" && rule("robot-hat-eye") {
+			robotImage := traitImage("Eyes", "robot")
+			drawImage(crop(robotImage, image.Rect(855, 355, 905, 430)))
+		}
+
+		if isBackwardBandana && isRobot && trait.TraitType == "Jewelry" && rule("backwards-bandana-robot") {
+			robotImage := traitImage("Eyes", "robot")
+			drawImage(crop(robotImage, image.Rect(0, 0, r.Max.X, 450)))
+		}
+
+		if isLasers && trait.TraitType == "Jewelry" && rule("eth-lasers") {
+			drawImage(special("Laser"))
+		}
+
+		if isJoint && trait.TraitType == "Jewelry" && rule("joint-smoke") {
+			drawImage(special("Joint Smoke"))
+		}
+
+		replaced = false
+		if trait.TraitKey == NoneKey {
+			continue
+		}
+
+		step = ""
+		drawImage(traitImage(trait.TraitType, trait.TraitKey))
+	}
+
+	if o != nil {
+		g.visibility(m, o, trace)
+	}
+
+	if m.Mutation != "" {
+		trace.Steps = append(trace.Steps, Step{Op: StepMutation, Image: m.Mutation})
+		g.applyMutation(newImage, m)
+	}
+
+	return newImage, trace, nil
+}
@@ -0,0 +1,117 @@
+package abbc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderTrace(t *testing.T) {
+	g := testPack(t, nil)
+
+	m := &Metadata{Traits: []MetadataTrait{
+		{TraitType: "Background", TraitKey: "gray"},
+		{TraitType: "Fur", TraitKey: "brown"},
+		{TraitType: "Clothes", TraitKey: "hoodie"},
+		{TraitType: "Eyes", TraitKey: "thin-shades"},
+		{TraitType: "Head", TraitKey: "army-helmet"},
+		{TraitType: "Mouth", TraitKey: "grin"},
+		{TraitType: "Jewelry", TraitKey: "chain"},
+	}}
+	_, trace, err := g.RenderTrace(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, step := range trace.Steps {
+		got = append(got, fmt.Sprintf("%s %s %s %s", step.Layer, step.Op, step.Image, step.Rule))
+	}
+	want := []string{
+		"Background draw Background=gray ",
+		"Fur draw Fur=brown ",
+		"Clothes mask  helmet-mask",
+		"Clothes draw Clothes=hoodie ",
+		"Eyes draw Eyes=bored glasses-over-head",
+		"Head draw Head=army-helmet ",
+		"Mouth draw Eyes=thin-shades glasses-over-head",
+		"Mouth draw Head=army-helmet helmet-over-glasses",
+		"Mouth draw Mouth=grin ",
+		"Jewelry draw Jewelry=chain ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("steps:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if crop := trace.Steps[7].Crop; crop == nil {
+		t.Error("helmet over glasses not cropped")
+	}
+}
+
+func TestRenderCutout(t *testing.T) {
+	g := testPack(t, nil)
+	m, err := g.GenerateMetadata(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backgrounds fill the pack squares, so the corner only shows them.
+	img, err := g.Render(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("token corner alpha %#x, want opaque", a)
+	}
+	cutout, err := g.RenderCutout(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := cutout.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("cutout corner alpha %#x, want transparent", a)
+	}
+}
+
+func TestRenderMultiSelect(t *testing.T) {
+	g := testPack(t, func(c *Config) {
+		jewelry := c.Traits["Jewelry"]
+		pin := jewelry.Values[0]
+		pin.Key, pin.Name = "pin", "Pin"
+		jewelry.Values = append(jewelry.Values, pin)
+		jewelry.Max = 3
+		c.Traits["Jewelry"] = jewelry
+	})
+
+	// eth-lasers draws the Laser on the Jewelry turn, which has to come
+	// exactly once however many values Jewelry picked.
+	for _, jewelry := range [][]string{nil, {"chain"}, {"chain", "pin"}} {
+		m := &Metadata{Traits: []MetadataTrait{
+			{TraitType: "Background", TraitKey: "gray"},
+			{TraitType: "Fur", TraitKey: "brown"},
+			{TraitType: "Clothes", TraitKey: "hoodie"},
+			{TraitType: "Eyes", TraitKey: "eth-lasers"},
+			{TraitType: "Head", TraitKey: "sweatband"},
+			{TraitType: "Mouth", TraitKey: "grin"},
+		}}
+		want := []string{"special:Laser eth-lasers"}
+		for _, key := range jewelry {
+			m.Traits = append(m.Traits, MetadataTrait{TraitType: "Jewelry", TraitKey: key})
+			want = append(want, "Jewelry="+key+" ")
+		}
+		_, trace, err := g.RenderTrace(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, step := range trace.Steps {
+			if step.Layer == "Jewelry" {
+				got = append(got, step.Image+" "+step.Rule)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d values: Jewelry steps %q, want %q", len(jewelry), got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package abbc
+
+import "fmt"
+
+// Rule is a named special case in Render. Rules can be switched off
+// per collection with the rules.disable list in the config.
+type Rule struct {
+	Name        string
+	Description string
+}
+
+var Rules = []Rule{
+	{"trooper-hat-right", "Trooper Hat right flap drawn under the eyes"},
+	{"glasses-over-head", "Glasses drawn after the head with Bored eyes underneath"},
+	{"beanie-oversized", "Beanie and Oversized glasses use the combined special images"},
+	{"backwards-bandana-thick-frames", "Thick Frames cut for the Backwards Bandana"},
+	{"blonde-braids-oversized", "Oversized glasses cut for Blonde Braids"},
+	{"goggles-robot-head", "Goggles cut around the Robot eyes"},
+	{"big-head-over-glasses", "Large hair and hats redrawn over the glasses"},
+	{"helmet-over-glasses", "Top of the Army Helmet redrawn over the glasses"},
+	{"goggles-over-glasses", "Left side of the goggles redrawn over the glasses"},
+	{"trooper-hat-bandana", "Trooper Hat with the Bandana mouth"},
+	{"sakura-mouth", "Mouth redrawn over Sakura"},
+	{"braids-over-jewelry", "Two Tone Braids and Dreadlocks redrawn on top"},
+	{"grin-left", "Left side of the grin drawn over Trooper Hat and Backwards Hat"},
+	{"hat-rose", "Rose redrawn over Trooper Hat and Backwards Hat"},
+	{"plasma-vision-over-hat", "Plasma Vision redrawn over hats and bandanas"},
+	{"helmet-mask", "Background painted over the clothes behind the Army Helmet strap"},
+	{"bandana-left", "Left side of the Bandana mouth drawn over the Backwards Hat"},
+	{"plasma-vision-head", "Plasma Vision bottom drawn after the head"},
+	{"trooper-rose", "Rose redrawn over the Trooper Hat"},
+	{"flame-shades-over-hat", "Flame Shades drawn over Trooper Hat and Army Helmet"},
+	{"panel-hat-sport-shades", "Panel Hat redrawn over Sport Shades"},
+	{"puffer-grin", "Grin mouths cut for the Zipped Puffer collar"},
+	{"puffer-small-grin", "Small Grin cut for the Zipped Puffer collar"},
+	{"puffer-rose", "Rose cut for the Zipped Puffer collar"},
+	{"puffer-discomfort", "Discomfort cut for the Zipped Puffer collar"},
+	{"puffer-bored", "Bored mouths cut for the Zipped Puffer collar"},
+	{"puffer-bored-unshaven", "Bored Unshaven cut for the Zipped Puffer collar"},
+	{"puffer-phoneme-vuh", "Phoneme Vuh cut for the Zipped Puffer collar"},
+	{"puffer-tongue", "Tongue cut for the Zipped Puffer collar"},
+	{"backwards-bandana-over-glasses", "Backwards Bandana redrawn over small glasses"},
+	{"robot-hat-eye", "Robot eye redrawn over Panel Hat"},
+	{"backwards-bandana-robot", "Top of the Robot eyes redrawn over the Backwards Bandana"},
+	{"eth-lasers", "Laser beams for ETH Lasers"},
+	{"joint-smoke", "Smoke for Bored Joint"},
+}
+
+func isRule(name string) bool {
+	for _, r := range Rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleLayerOrder is the order the rules need these trait types drawn in.
+// Glasses and heads are held back on their own turn and drawn on the turn of
+// a later type, so drawing that type first would lose them.
+var ruleLayerOrder = []string{"Eyes", "Head", "Mouth", "Jewelry"}
+
+// checkRuleLayers returns an error if layers draws the types of
+// ruleLayerOrder in another order, unless every rule is disabled.
+func checkRuleLayers(layers []string, disabled map[string]bool) error {
+	enabled := false
+	for _, rule := range Rules {
+		if !disabled[rule.Name] {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	last := ""
+	for _, traitType := range ruleLayerOrder {
+		for i, layer := range layers {
+			if layer != traitType {
+				continue
+			}
+			if last != "" && i < indexOf(layers, last) {
+				return fmt.Errorf("layers draw %s before %s, which the rules do not support; disable every rule to draw them in that order", traitType, last)
+			}
+			last = traitType
+		}
+	}
+	return nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// ruleTraitTypes are the trait types whose turn in Render can fire a rule.
+// Other layers are drawn as they are, so a composite of them can be reused
+// between tokens.
+var ruleTraitTypes = map[string]bool{
+	"Clothes": true,
+	"Eyes":    true,
+	"Head":    true,
+	"Jewelry": true,
+	"Mouth":   true,
+}
@@ -0,0 +1,28 @@
+package abbc
+
+import "testing"
+
+func TestCheckRuleLayers(t *testing.T) {
+	allDisabled := map[string]bool{}
+	for _, rule := range Rules {
+		allDisabled[rule.Name] = true
+	}
+	for _, tc := range []struct {
+		layers   []string
+		disabled map[string]bool
+		ok       bool
+	}{
+		{[]string{"Background", "Fur", "Clothes", "Eyes", "Head", "Mouth", "Jewelry"}, nil, true},
+		{[]string{"Background", "Eyes", "Fur", "Head", "Clothes", "Mouth", "Jewelry"}, nil, true},
+		{[]string{"Background", "Fur", "Head", "Jewelry"}, nil, true},
+		{[]string{"Background", "Fur", "Eyes", "Mouth", "Head", "Jewelry"}, nil, false},
+		{[]string{"Background", "Jewelry", "Eyes", "Head", "Mouth"}, nil, false},
+		{[]string{"Background", "Jewelry", "Eyes", "Head", "Mouth"}, map[string]bool{"eth-lasers": true}, false},
+		{[]string{"Background", "Jewelry", "Eyes", "Head", "Mouth"}, allDisabled, true},
+	} {
+		err := checkRuleLayers(tc.layers, tc.disabled)
+		if (err == nil) != tc.ok {
+			t.Errorf("%v: got %v, want ok %v", tc.layers, err, tc.ok)
+		}
+	}
+}
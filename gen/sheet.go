@@ -0,0 +1,146 @@
+package abbc
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Sheet layout in pixels.
+const (
+	sheetPadding    = 8
+	sheetLineHeight = 16
+)
+
+// A SheetCell is one thumbnail of a contact sheet with the lines of text
+// printed under it.
+type SheetCell struct {
+	Image image.Image
+	Label []string
+}
+
+// ParseTraits parses a list like "Fur=Dark Brown,Background=Gray" into traits.
+// Values can be given as trait keys or display names, in any case.
+func (g *Generator) ParseTraits(s string) ([]MetadataTrait, error) {
+	traits := []MetadataTrait{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("trait %q is not Type=value", pair)
+		}
+		trait, err := g.FindTrait(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		traits = append(traits, trait)
+	}
+	return traits, nil
+}
+
+// FindTrait returns the trait of the given type whose key or display name
+// is value, ignoring case.
+func (g *Generator) FindTrait(traitType, value string) (MetadataTrait, error) {
+	for _, layer := range g.Config.Layers {
+		if !strings.EqualFold(layer, traitType) {
+			continue
+		}
+		for key, trait := range g.TraitMaps[layer] {
+			if strings.EqualFold(key, value) || strings.EqualFold(trait.TraitValue, value) {
+				return MetadataTrait{TraitType: layer, TraitKey: key, TraitValue: trait.TraitValue}, nil
+			}
+		}
+		return MetadataTrait{}, fmt.Errorf("%s has no value %q", layer, value)
+	}
+	return MetadataTrait{}, fmt.Errorf("unknown trait type %q", traitType)
+}
+
+// Sheet renders every value of traitType over the base traits, in config
+// order, and lays them out in a grid labelled with the display name and
+// chance of each value. Layers not in base are left empty.
+func (g *Generator) Sheet(ctx context.Context, traitType string, base []MetadataTrait, columns, cell int) (*image.RGBA, error) {
+	cells := []SheetCell{}
+	for _, key := range g.traitKeys(traitType) {
+		traits := append(append([]MetadataTrait{}, base...), MetadataTrait{TraitType: traitType, TraitKey: key})
+		img, err := g.Render(ctx, g.layerMetadata(traits))
+		if err != nil {
+			return nil, err
+		}
+		chance := float64(g.TraitMaps[traitType][key].TraitProbability) / 10
+		cells = append(cells, SheetCell{
+			Image: img,
+			Label: []string{g.traitLabel(traitType, key), fmt.Sprintf("%.1f%%", chance)},
+		})
+	}
+	return Grid(cells, columns, cell), nil
+}
+
+// layerMetadata returns a token made of the given traits, later ones taking
+// the place of earlier ones of the same type. Layers without a trait are
+// left empty.
+func (g *Generator) layerMetadata(traits []MetadataTrait) *Metadata {
+	byType := map[string]MetadataTrait{}
+	for _, trait := range traits {
+		byType[trait.TraitType] = trait
+	}
+	m := &Metadata{}
+	for _, traitType := range g.Config.Layers {
+		trait, ok := byType[traitType]
+		if !ok {
+			trait = MetadataTrait{TraitType: traitType, TraitKey: NoneKey}
+		}
+		m.Traits = append(m.Traits, trait)
+	}
+	return m
+}
+
+// Grid lays out cells left to right in rows of columns, each image scaled to
+// cell pixels square with its label underneath, on white.
+func Grid(cells []SheetCell, columns, cell int) *image.RGBA {
+	if columns > len(cells) {
+		columns = len(cells)
+	}
+	if columns < 1 {
+		columns = 1
+	}
+	lines := 0
+	for _, c := range cells {
+		if len(c.Label) > lines {
+			lines = len(c.Label)
+		}
+	}
+	rows := (len(cells) + columns - 1) / columns
+	cellWidth := cell + sheetPadding
+	cellHeight := cell + lines*sheetLineHeight + sheetPadding
+	sheet := image.NewRGBA(image.Rect(0, 0, sheetPadding+columns*cellWidth, sheetPadding+rows*cellHeight))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: sheet, Src: image.NewUniform(color.Black), Face: basicfont.Face7x13}
+	for i, c := range cells {
+		x := sheetPadding + i%columns*cellWidth
+		y := sheetPadding + i/columns*cellHeight
+		thumb := image.Rect(x, y, x+cell, y+cell)
+		if c.Image != nil {
+			xdraw.CatmullRom.Scale(sheet, thumb, c.Image, c.Image.Bounds(), xdraw.Over, nil)
+		}
+		for j, line := range c.Label {
+			for len(line) > 1 && d.MeasureString(line).Ceil() > cell {
+				line = line[:len(line)-1]
+			}
+			d.Dot = fixed.P(x, y+cell+(j+1)*sheetLineHeight-3)
+			d.DrawString(line)
+		}
+	}
+	return sheet
+}
@@ -0,0 +1,59 @@
+package abbc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"abbc/gen/abbctest"
+)
+
+func TestParseTraits(t *testing.T) {
+	g := testPack(t, nil)
+	for _, tc := range []struct {
+		in   string
+		want []MetadataTrait
+	}{
+		{"background=Gray, Fur=brown", []MetadataTrait{
+			{TraitType: "Background", TraitKey: "gray", TraitValue: "Gray"},
+			{TraitType: "Fur", TraitKey: "brown", TraitValue: "Brown"},
+		}},
+		{"Mouth=small grin", []MetadataTrait{{TraitType: "Mouth", TraitKey: "small-grin", TraitValue: "Small Grin"}}},
+		{"Fur=purple", nil},
+		{"Hat=beanie", nil},
+	} {
+		got, err := g.ParseTraits(tc.in)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%q parsed as %v", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q parsed as %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestSheet(t *testing.T) {
+	g := testPack(t, nil)
+	base, err := g.ParseTraits("Background=gray, Fur=brown")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sheet, err := g.Sheet(context.Background(), "Mouth", base, 4, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sheet.Bounds().Dx(); got != 8+4*(64+8) {
+		t.Errorf("sheet is %d pixels wide", got)
+	}
+	if rows := (len(abbctest.Traits["Mouth"]) + 3) / 4; sheet.Bounds().Dy() != 8+rows*(64+2*16+8) {
+		t.Errorf("sheet is %d pixels high, want %d rows", sheet.Bounds().Dy(), rows)
+	}
+}
@@ -0,0 +1,343 @@
+package abbc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// A Token is a rendered token on its way to a Sink.
+type Token struct {
+	Metadata *Metadata
+	JSON     *TokenMetadata
+	Image    image.Image
+	Trace    *Trace
+
+	// Seed is the generator seed the traits were picked with.
+	Seed int64
+
+	// Inputs holds the SHA-256 of the files in Trace.Files as they were
+	// when the token was rendered.
+	Inputs map[string]string
+
+	// Variants are other images of the token, such as the cutout.
+	Variants []*Variant
+
+	// VariantDirs are the folders the config writes variants to, including
+	// those the token has none in, such as animations for a still token.
+	VariantDirs []string
+
+	// Encoded is the PNG encoding of Image, filled in by Encode.
+	Encoded []byte
+
+	encoder *Encoder
+}
+
+// A Variant is another image of a token, written to a folder of its own.
+// With Frames it is an animated GIF instead, and with Quality a JPEG, both
+// scaled to Size.
+type Variant struct {
+	Dir     string
+	Image   image.Image
+	Frames  []image.Image
+	Delays  []int
+	Quality int
+	Size    int
+	Encoded []byte
+}
+
+// variantExts are the file extensions variants are written with.
+var variantExts = []string{".png", ".gif", ".jpg"}
+
+// ext returns the file extension of the variant.
+func (v *Variant) ext() string {
+	switch {
+	case v.Frames != nil:
+		return ".gif"
+	case v.Quality > 0:
+		return ".jpg"
+	}
+	return ".png"
+}
+
+func (v *Variant) encode(e *Encoder) ([]byte, error) {
+	switch {
+	case v.Frames != nil:
+		return encodeGIF(v.Frames, v.Delays, v.Size)
+	case v.Quality > 0:
+		return JPEG(v.Image, v.Quality, v.Size)
+	}
+	return e.PNG(v.Image)
+}
+
+// VariantDirs returns the folders under the output directory that the
+// config writes variants of tokens to.
+func (c *Config) VariantDirs() []string {
+	dirs := []string{}
+	if c.Cutout != nil {
+		dirs = append(dirs, c.Cutout.Dir)
+	}
+	if c.Animation != nil {
+		dirs = append(dirs, c.Animation.Dir)
+	}
+	if c.Preview != nil {
+		dirs = append(dirs, c.Preview.Dir)
+	}
+	for _, layout := range c.Layouts {
+		if layout.Dir != "" {
+			dirs = append(dirs, layout.Dir)
+		}
+	}
+	return dirs
+}
+
+// checkVariantDirs returns an error if two kinds of variant in c go to the
+// same folder, or one to the output directory itself. Their files would
+// overwrite each other and share one journal entry.
+func checkVariantDirs(c *Config) error {
+	used := make(map[string]string)
+	add := func(what, dir string) error {
+		clean := path.Clean(filepath.ToSlash(dir))
+		if clean == "." {
+			return fmt.Errorf("%s dir %q is the output directory", what, dir)
+		}
+		if other, ok := used[clean]; ok {
+			return fmt.Errorf("%s and %s both write to %q", other, what, dir)
+		}
+		used[clean] = what
+		return nil
+	}
+	var err error
+	if c.Cutout != nil {
+		err = add("cutout", c.Cutout.Dir)
+	}
+	if err == nil && c.Animation != nil {
+		err = add("animation", c.Animation.Dir)
+	}
+	if err == nil && c.Preview != nil {
+		err = add("preview", c.Preview.Dir)
+	}
+	for i, layout := range c.Layouts {
+		if err == nil && layout.Dir != "" {
+			err = add(fmt.Sprintf("layout %d", i+1), layout.Dir)
+		}
+	}
+	return err
+}
+
+// Token renders m and wraps it with its metadata JSON. When the config asks
+// to re-roll tokens with hidden traits, the traits may be picked again.
+// Errors are returned as a *TokenError.
+func (g *Generator) Token(ctx context.Context, m *Metadata) (*Token, error) {
+	img, trace, err := g.RenderTrace(ctx, m)
+	for err == nil && len(trace.Hidden) > 0 && g.Config.Visibility.Reroll && m.Attempt < g.maxRerolls() {
+		m, err = g.Reroll(m)
+		if err == nil {
+			img, trace, err = g.RenderTrace(ctx, m)
+		}
+	}
+	if err != nil {
+		return nil, &TokenError{TokenID: m.TokenID, Traits: m.Traits, Err: err}
+	}
+	t := &Token{
+		Metadata: m,
+		JSON:     g.TokenMetadata(m),
+		Image:    img,
+		Trace:    trace,
+		Seed:     g.Seed,
+		encoder:  g.encoder,
+
+		VariantDirs: g.Config.VariantDirs(),
+	}
+	if g.Config.Cutout != nil {
+		cutout, err := g.RenderCutout(ctx, m)
+		if err != nil {
+			return nil, &TokenError{TokenID: m.TokenID, Traits: m.Traits, Err: fmt.Errorf("cutout: %w", err)}
+		}
+		t.Variants = append(t.Variants, &Variant{Dir: g.Config.Cutout.Dir, Image: cutout})
+	}
+	if a := g.Config.Animation; a != nil {
+		frames, delays, err := g.RenderFrames(ctx, m, trace)
+		if err != nil {
+			return nil, &TokenError{TokenID: m.TokenID, Traits: m.Traits, Err: fmt.Errorf("animation: %w", err)}
+		}
+		if frames != nil {
+			t.Variants = append(t.Variants, &Variant{Dir: a.Dir, Frames: frames, Delays: delays, Size: a.Size})
+			t.JSON.AnimationURL = tokenURI(a.URI, m.TokenID, ".gif")
+		}
+	}
+	t.Inputs = g.hashInputs(trace.Files)
+	if p := g.Config.Preview; p != nil {
+		t.Variants = append(t.Variants, &Variant{Dir: p.Dir, Image: img, Quality: p.Quality, Size: p.Size})
+	}
+	for i, layout := range g.Config.Layouts {
+		canvas, err := g.RenderLayout(ctx, m, img, i)
+		if err != nil {
+			return nil, &TokenError{TokenID: m.TokenID, Traits: m.Traits, Err: err}
+		}
+		t.Variants = append(t.Variants, &Variant{Dir: layout.Dir, Image: canvas})
+	}
+	return t, nil
+}
+
+// Encode encodes the token image and its variants as PNG, GIF for
+// animations and JPEG for previews, unless that was already done. Tokens
+// from Generator.Token use the encoding of the config.
+func (t *Token) Encode() error {
+	e := t.encoder
+	if e == nil {
+		e = defaultEncoder
+	}
+	if t.Encoded == nil {
+		encoded, err := e.PNG(t.Image)
+		if err != nil {
+			return err
+		}
+		t.Encoded = encoded
+	}
+	for _, v := range t.Variants {
+		if v.Encoded != nil {
+			continue
+		}
+		encoded, err := v.encode(e)
+		if err != nil {
+			return fmt.Errorf("%s: %w", v.Dir, err)
+		}
+		v.Encoded = encoded
+	}
+	return nil
+}
+
+var defaultEncoder, _ = NewEncoder(EncodeConfig{})
+
+// A Sink receives rendered tokens. Sinks are safe for concurrent use.
+type Sink interface {
+	Write(t *Token) error
+}
+
+// DirSink writes {id}.png and {id}.json for every token into Dir, and with
+// Traces the render trace as {id}.trace.json. Variants are written as
+// {id}.png, {id}.gif if animated or {id}.jpg for previews, into their
+// folder under Dir. Files are written under a temporary name and renamed
+// into place. With a Journal, every finished token is recorded in it, and
+// with a Graph its inputs.
+type DirSink struct {
+	Dir     string
+	Traces  bool
+	Journal *Journal
+	Graph   *BuildGraph
+}
+
+func (s *DirSink) Write(t *Token) error {
+	err := t.Encode()
+	if err != nil {
+		return err
+	}
+
+	imagePath := filepath.Join(s.Dir, fmt.Sprintf("%d.png", t.Metadata.TokenID))
+	err = writeFile(imagePath, t.Encoded)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.MarshalIndent(t.JSON, "", "  ")
+	if err != nil {
+		return err
+	}
+	metadata = append(metadata, '\n')
+	metadataPath := filepath.Join(s.Dir, fmt.Sprintf("%d.json", t.Metadata.TokenID))
+	err = writeFile(metadataPath, metadata)
+	if err != nil {
+		return err
+	}
+
+	variants := map[string]string{}
+	for _, v := range t.Variants {
+		err = os.MkdirAll(filepath.Join(s.Dir, v.Dir), 0777)
+		if err != nil {
+			return err
+		}
+		variantPath := filepath.Join(s.Dir, v.Dir, fmt.Sprintf("%d%s", t.Metadata.TokenID, v.ext()))
+		err = writeFile(variantPath, v.Encoded)
+		if err != nil {
+			return err
+		}
+		variants[v.Dir] = hash(v.Encoded)
+	}
+
+	if s.Traces && t.Trace != nil {
+		trace, err := json.MarshalIndent(t.Trace, "", "  ")
+		if err != nil {
+			return err
+		}
+		tracePath := filepath.Join(s.Dir, fmt.Sprintf("%d.trace.json", t.Metadata.TokenID))
+		err = writeFile(tracePath, append(trace, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Graph != nil {
+		s.Graph.Add(t)
+	}
+	if s.Journal == nil {
+		return nil
+	}
+	return s.Journal.Add(JournalEntry{
+		TokenID:  t.Metadata.TokenID,
+		Seed:     t.Seed,
+		PNG:      hash(t.Encoded),
+		JSON:     hash(metadata),
+		Variants: variants,
+		Dirs:     t.VariantDirs,
+	})
+}
+
+// WriterSink writes the PNG of every token to W, for example a single
+// preview to stdout or an HTTP response.
+type WriterSink struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func (s *WriterSink) Write(t *Token) error {
+	err := t.Encode()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.W.Write(t.Encoded)
+	return err
+}
+
+// MemorySink keeps every token in memory by token ID.
+type MemorySink struct {
+	mu     sync.Mutex
+	tokens map[int]*Token
+}
+
+func (s *MemorySink) Write(t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[int]*Token)
+	}
+	s.tokens[t.Metadata.TokenID] = t
+	return nil
+}
+
+// Get returns the token written with the given ID, or nil.
+func (s *MemorySink) Get(tokenID int) *Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[tokenID]
+}
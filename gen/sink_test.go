@@ -0,0 +1,103 @@
+package abbc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVariantDirs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Config
+		ok   bool
+	}{
+		{"none", Config{}, true},
+		{"all", Config{
+			Cutout:    &CutoutConfig{Dir: "cutouts"},
+			Animation: &AnimationConfig{Dir: "animations"},
+			Preview:   &PreviewConfig{Dir: "previews"},
+		}, true},
+		{"shared", Config{
+			Cutout:  &CutoutConfig{Dir: "extra"},
+			Preview: &PreviewConfig{Dir: "extra/"},
+		}, false},
+		{"output dir", Config{Animation: &AnimationConfig{Dir: "./"}}, false},
+		{"layouts", Config{
+			Cutout:  &CutoutConfig{Dir: "cutouts"},
+			Layouts: []Layout{{Dir: "cards"}, {Dir: "banners"}},
+		}, true},
+		{"layout over cutouts", Config{
+			Cutout:  &CutoutConfig{Dir: "cutouts"},
+			Layouts: []Layout{{Dir: "cards"}, {Dir: "cutouts"}},
+		}, false},
+		{"two layouts", Config{Layouts: []Layout{{Dir: "cards"}, {Dir: "./cards"}}}, false},
+	} {
+		err := checkVariantDirs(&tc.c)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: got %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestTokenVariants(t *testing.T) {
+	animate := func(c *Config) {
+		backgrounds := c.Traits["Background"]
+		for i := range backgrounds.Values {
+			other := backgrounds.Values[(i+1)%len(backgrounds.Values)]
+			backgrounds.Values[i].Frames = []Frame{{File: backgrounds.Values[i].File}, {File: other.File}}
+		}
+		c.Animation = &AnimationConfig{Dir: "animations", URI: "ipfs://animations"}
+	}
+	for _, tc := range []struct {
+		name      string
+		edit      func(c *Config)
+		files     []string
+		cutout    string
+		animation string
+	}{
+		{"none", nil, nil, "", ""},
+		{"cutout", func(c *Config) {
+			c.Cutout = &CutoutConfig{Dir: "cutouts", URI: "ipfs://cutouts/"}
+		}, []string{"cutouts/3.png"}, "ipfs://cutouts/3.png", ""},
+		{"layouts", func(c *Config) {
+			c.Layouts = []Layout{{Dir: "cards", Width: 64, Height: 32}, {Dir: "banners", Width: 96, Height: 32}}
+		}, []string{"cards/3.png", "banners/3.png"}, "", ""},
+		{"preview", func(c *Config) {
+			c.Preview = &PreviewConfig{Dir: "previews", Quality: 70}
+		}, []string{"previews/3.jpg"}, "", ""},
+		{"animation", animate, []string{"animations/3.gif"}, "", "ipfs://animations/3.gif"},
+	} {
+		g := testPack(t, func(c *Config) {
+			c.ImageURI = "ipfs://tokens"
+			if tc.edit != nil {
+				tc.edit(c)
+			}
+		})
+		m, err := g.GenerateMetadata(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := g.Token(context.Background(), m)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if token.JSON.Image != "ipfs://tokens/3.png" || token.JSON.CutoutImage != tc.cutout || token.JSON.AnimationURL != tc.animation {
+			t.Errorf("%s: image %q, cutout %q, animation %q", tc.name, token.JSON.Image, token.JSON.CutoutImage, token.JSON.AnimationURL)
+		}
+		if len(token.Variants) != len(tc.files) {
+			t.Errorf("%s: %d variants, want %d", tc.name, len(token.Variants), len(tc.files))
+		}
+
+		dir := t.TempDir()
+		if err := (&DirSink{Dir: dir}).Write(token); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for _, file := range tc.files {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+		}
+	}
+}
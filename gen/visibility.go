@@ -0,0 +1,150 @@
+package abbc
+
+import (
+	"image"
+)
+
+// VisibilityConfig sets how much of each trait must show in the finished
+// token. With MinPercent set, the share of every trait's opaque pixels that
+// end up on top is recorded in the render trace, and traits below it are
+// listed as hidden. With Reroll, a token with hidden traits gets its traits
+// picked again, up to MaxRerolls times (default 10).
+type VisibilityConfig struct {
+	MinPercent float64 `yaml:"min_percent,omitempty"`
+	Reroll     bool    `yaml:"reroll,omitempty"`
+	MaxRerolls int     `yaml:"max_rerolls,omitempty"`
+}
+
+func (g *Generator) maxRerolls() int {
+	if g.Config.Visibility.MaxRerolls > 0 {
+		return g.Config.Visibility.MaxRerolls
+	}
+	return 10
+}
+
+// owners tracks which trait drew each pixel of a canvas last. Special images
+// count for the trait of the type they stand in for.
+type owners struct {
+	rect  image.Rectangle
+	pix   []uint8
+	names []string
+	of    map[image.Image]uint8
+}
+
+func newOwners(r image.Rectangle) *owners {
+	return &owners{
+		rect:  r,
+		pix:   make([]uint8, r.Dx()*r.Dy()),
+		names: []string{""},
+		of:    make(map[image.Image]uint8),
+	}
+}
+
+// name records img as drawn for the trait called owner.
+func (o *owners) name(img image.Image, owner string) {
+	if img == nil || owner == "" {
+		return
+	}
+	for i, name := range o.names {
+		if name == owner {
+			o.of[img] = uint8(i)
+			return
+		}
+	}
+	if len(o.names) == 256 {
+		return
+	}
+	o.of[img] = uint8(len(o.names))
+	o.names = append(o.names, owner)
+}
+
+// mark gives the opaque pixels of img to its owner. Pixels of images without
+// one belong to nobody.
+func (o *owners) mark(img image.Image) {
+	if img == nil {
+		return
+	}
+	owner := o.of[img]
+	r := img.Bounds().Intersect(o.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if opaque(img, x, y) {
+				o.pix[(y-o.rect.Min.Y)*o.rect.Dx()+x-o.rect.Min.X] = owner
+			}
+		}
+	}
+}
+
+// clear gives the pixels in r to nobody.
+func (o *owners) clear(r image.Rectangle) {
+	r = r.Intersect(o.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			o.pix[(y-o.rect.Min.Y)*o.rect.Dx()+x-o.rect.Min.X] = 0
+		}
+	}
+}
+
+// counts returns the number of pixels each trait owns.
+func (o *owners) counts() map[string]int {
+	n := make([]int, len(o.names))
+	for _, owner := range o.pix {
+		n[owner]++
+	}
+	counts := make(map[string]int)
+	for i, name := range o.names[1:] {
+		counts[name] = n[i+1]
+	}
+	return counts
+}
+
+// visibility fills in the visible share of every trait of m in trace and
+// lists those below the threshold as hidden.
+func (g *Generator) visibility(m *Metadata, o *owners, trace *Trace) {
+	counts := o.counts()
+	trace.Visible = make(map[string]float64)
+	for _, trait := range m.Traits {
+		img := g.TraitMaps[trait.TraitType][trait.TraitKey].TraitImage
+		if trait.TraitKey == NoneKey || img == nil {
+			continue
+		}
+		name := traitName(trait)
+		total := opaquePixels(img)
+		if total == 0 {
+			continue
+		}
+		percent := 100 * float64(counts[name]) / float64(total)
+		if percent > 100 {
+			percent = 100
+		}
+		trace.Visible[name] = percent
+		if percent < g.Config.Visibility.MinPercent {
+			trace.Hidden = append(trace.Hidden, name)
+		}
+	}
+}
+
+func opaquePixels(img image.Image) int {
+	n := 0
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if opaque(img, x, y) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func opaque(img image.Image, x, y int) bool {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba.Pix[rgba.PixOffset(x, y)+3] >= 0x80
+	}
+	_, _, _, a := img.At(x, y).RGBA()
+	return a >= 0x8000
+}
+
+func traitName(trait MetadataTrait) string {
+	return trait.TraitType + "=" + trait.TraitKey
+}
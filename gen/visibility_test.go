@@ -0,0 +1,55 @@
+package abbc
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestVisibility(t *testing.T) {
+	g := &Generator{
+		Config: &Config{Visibility: VisibilityConfig{MinPercent: 5}},
+		TraitMaps: map[string]map[string]TraitData{
+			"Background": {
+				"gray": {TraitImage: solidLayer(image.Rect(0, 0, 1262, 1262), color.Gray{128})},
+			},
+			"Clothes": {
+				"scarf": {TraitImage: solidLayer(image.Rect(400, 900, 800, 1000), color.Black)},
+			},
+			"Head": {
+				"hood": {TraitImage: solidLayer(image.Rect(300, 800, 900, 1262), color.White)},
+				"cap":  {TraitImage: solidLayer(image.Rect(400, 100, 800, 300), color.White)},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		head   string
+		scarf  float64
+		hidden []string
+	}{
+		{"cap", 100, nil},
+		{"hood", 0, []string{"Clothes=scarf"}},
+	} {
+		m := &Metadata{Traits: []MetadataTrait{
+			{TraitType: "Background", TraitKey: "gray"},
+			{TraitType: "Clothes", TraitKey: "scarf"},
+			{TraitType: "Head", TraitKey: tc.head},
+		}}
+		_, trace, err := g.RenderTrace(context.Background(), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := trace.Visible["Clothes=scarf"]; got != tc.scarf {
+			t.Errorf("%s: scarf is %v%% visible, want %v%%", tc.head, got, tc.scarf)
+		}
+		if got := trace.Visible["Head="+tc.head]; got != 100 {
+			t.Errorf("%s: head is %v%% visible, want 100%%", tc.head, got)
+		}
+		if !reflect.DeepEqual(trace.Hidden, tc.hidden) {
+			t.Errorf("%s: hidden %v, want %v", tc.head, trace.Hidden, tc.hidden)
+		}
+	}
+}